@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// [ass] section of config file
+type AssStyle struct {
+	Font         string
+	Size         int
+	Bold         bool
+	Outline      float64
+	Shadow       float64
+	PrimaryColor string `toml:"primary_color"`
+	OutlineColor string `toml:"outline_color"`
+	BackColor    string `toml:"back_color"`
+	MarginL      int    `toml:"margin_l"`
+	MarginR      int    `toml:"margin_r"`
+	MarginV      int    `toml:"margin_v"`
+}
+
+var defaultAssStyle = AssStyle{
+	Font:         "Arial",
+	Size:         48,
+	Outline:      2,
+	Shadow:       1,
+	PrimaryColor: "#FFFFFF",
+	OutlineColor: "#000000",
+	BackColor:    "&H80000000",
+	MarginL:      20,
+	MarginR:      20,
+	MarginV:      30,
+}
+
+// Style used by FormatSubtitles, overwritten by config file
+var assStyle = defaultAssStyle
+
+func FormatASS(cues []Cue, style AssStyle, bilingual BilingualStyle) (string, error) {
+	styleLine, err := assStyleLine("Default", style)
+	if err != nil {
+		return "", err
+	}
+
+	// Separate style for original lines in bilingual subtitles
+	styled := bilingual.Styled && hasOriginal(cues)
+	if styled {
+		originalStyle := style
+		originalStyle.Size = style.Size * bilingual.Scale / 100
+		originalStyle.PrimaryColor = bilingual.Color
+		originalLine, err := assStyleLine("Original", originalStyle)
+		if err != nil {
+			return "", err
+		}
+		styleLine += "\n" + originalLine
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[Script Info]\n")
+	sb.WriteString("ScriptType: v4.00+\n")
+	sb.WriteString("PlayResX: 1280\n")
+	sb.WriteString("PlayResY: 720\n")
+	sb.WriteString("WrapStyle: 0\n")
+	sb.WriteString("ScaledBorderAndShadow: yes\n")
+	sb.WriteString("\n")
+
+	sb.WriteString("[V4+ Styles]\n")
+	sb.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+	sb.WriteString(styleLine + "\n")
+	sb.WriteString("\n")
+
+	sb.WriteString("[Events]\n")
+	sb.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	for _, cue := range cues {
+		text := assText(cue.Lines)
+		if len(cue.Original) > 0 {
+			original := assText(cue.Original)
+			if styled {
+				original = "{\\rOriginal}" + original + "{\\r}"
+			}
+			text = original + "\\N" + text
+		}
+		fmt.Fprintf(&sb, "Dialogue: 0,%s,%s,Default,,0,0,0,,%s\n", assTimestamp(cue.Start), assTimestamp(cue.End), text)
+	}
+
+	return sb.String(), nil
+}
+
+// Formatting tags of SRT and WebVTT with their ASS override codes
+var assTags = map[string]string{"i": "\\i", "b": "\\b", "u": "\\u", "s": "\\s"}
+
+// WebVTT tags without ASS equivalent, removed from text
+var removedTags = map[string]bool{"font": true, "c": true, "v": true, "lang": true, "ruby": true, "rt": true, "span": true}
+
+// Joins cue lines into ASS text. Basic tags are converted into override codes, other tags
+// are removed and braces and backslashes are escaped, so they aren't read as override codes.
+func assText(lines []string) string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		var sb strings.Builder
+		for j := 0; j < len(line); j++ {
+			if line[j] == '<' {
+				if end := strings.IndexByte(line[j:], '>'); end > 1 && !strings.Contains(line[j+1:j+end], "<") {
+					tag := strings.ToLower(line[j+1 : j+end])
+					closing := strings.HasPrefix(tag, "/")
+					name := strings.TrimPrefix(tag, "/")
+					// WebVTT class and annotation, e.g. <c.yellow> or <v Narrator>
+					if k := strings.IndexAny(name, ". "); k >= 0 {
+						name = name[:k]
+					}
+
+					if code, ok := assTags[name]; ok {
+						state := "1"
+						if closing {
+							state = "0"
+						}
+						sb.WriteString("{" + code + state + "}")
+						j += end
+						continue
+					}
+					// Timestamp tags of karaoke style WebVTT, e.g. <00:00:01.500>
+					if removedTags[name] || (name != "" && name[0] >= '0' && name[0] <= '9' && strings.Contains(name, ":")) {
+						j += end
+						continue
+					}
+				}
+			}
+
+			switch line[j] {
+			case '{', '}':
+				sb.WriteByte('\\')
+				sb.WriteByte(line[j])
+			case '\\':
+				// Word joiner breaks sequences like \N, same as ffmpeg
+				sb.WriteString("\\\u2060")
+			default:
+				sb.WriteByte(line[j])
+			}
+		}
+		escaped[i] = sb.String()
+	}
+	return strings.Join(escaped, "\\N")
+}
+
+func assStyleLine(name string, style AssStyle) (string, error) {
+	var colors []string
+	for _, value := range []string{style.PrimaryColor, style.OutlineColor, style.BackColor} {
+		color, err := assColor(value)
+		if err != nil {
+			return "", err
+		}
+		colors = append(colors, color)
+	}
+
+	bold := 0
+	if style.Bold {
+		bold = -1
+	}
+
+	return fmt.Sprintf("Style: %s,%s,%d,%s,&H000000FF,%s,%s,%d,0,0,0,100,100,0,0,1,%g,%g,2,%d,%d,%d,1",
+		name, style.Font, style.Size, colors[0], colors[1], colors[2], bold,
+		style.Outline, style.Shadow, style.MarginL, style.MarginR, style.MarginV), nil
+}
+
+// Converts "#RRGGBB" into ASS "&HAABBGGRR" format, ASS colors are returned unchanged
+func assColor(value string) (string, error) {
+	if strings.HasPrefix(value, "&H") {
+		return value, nil
+	}
+
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 || !strings.HasPrefix(value, "#") {
+		return "", fmt.Errorf("invalid ASS color %q, use #RRGGBB or &HAABBGGRR", value)
+	}
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil {
+		return "", fmt.Errorf("invalid ASS color %q, use #RRGGBB or &HAABBGGRR", value)
+	}
+
+	return strings.ToUpper("&H00" + hex[4:6] + hex[2:4] + hex[0:2]), nil
+}
+
+// Returns timestamp in H:MM:SS.cc format
+func assTimestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
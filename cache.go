@@ -0,0 +1,109 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// Translation responses stored on disk by hash of request
+type Cache struct {
+	dir string
+}
+
+// [cache] section of config file, used by --prune-cache
+type CacheConfig struct {
+	MaxSize int `toml:"max_size"` // MB
+	MaxAge  int `toml:"max_age"`  // days
+}
+
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+func CacheKey(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Nil cache (--no-cache) never returns anything
+func (c *Cache) Get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	filePath := path.Join(c.dir, key)
+	buff, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", false
+	}
+
+	// Modification time is used as last access time when pruning
+	now := time.Now()
+	os.Chtimes(filePath, now, now)
+	return string(buff), true
+}
+
+func (c *Cache) Put(key string, value string) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.MkdirAll(c.dir, os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(c.dir, key), []byte(value), 0644)
+}
+
+// Removes entries not used for maxAge, then least recently used ones until cache fits in maxSize.
+// Zero values disable given limit.
+func PruneCache(dir string, maxSize int64, maxAge time.Duration) (int, int64, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var files []os.FileInfo
+	var totalSize int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.IsDir() {
+			continue
+		}
+		files = append(files, info)
+		totalSize += info.Size()
+	}
+
+	// Oldest first
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().Before(files[j].ModTime())
+	})
+
+	var removed int
+	var freed int64
+	for _, file := range files {
+		expired := maxAge > 0 && time.Since(file.ModTime()) > maxAge
+		oversized := maxSize > 0 && totalSize > maxSize
+		if !expired && !oversized {
+			continue
+		}
+
+		if err := os.Remove(path.Join(dir, file.Name())); err != nil {
+			return removed, freed, err
+		}
+		removed++
+		freed += file.Size()
+		totalSize -= file.Size()
+	}
+
+	return removed, freed, nil
+}
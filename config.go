@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+// config.toml
+type Config struct {
+	Key            string
+	Threads        string
+	Model          string
+	Cpp            bool
+	SourceLang     string `toml:"source_lang"`
+	Whisper        WhisperConfig
+	Translator     string
+	ChunkTokens    int `toml:"chunk_tokens"`
+	ContextCues    int `toml:"context_cues"`
+	Ass            AssStyle
+	Bilingual      BilingualStyle
+	OpenAI         OpenAIConfig
+	Ollama         OllamaConfig
+	LibreTranslate LibreTranslateConfig
+	Retry          RetryPolicy
+	Cache          CacheConfig
+	Prompt         PromptConfig
+	Prices         map[string]ModelPrice
+}
+
+// [openai] section of config file
+type OpenAIConfig struct {
+	Url   string
+	Model string
+	Key   string
+}
+
+// [ollama] section of config file
+type OllamaConfig struct {
+	Host    string
+	Model   string
+	Context int
+}
+
+// [libretranslate] section of config file
+type LibreTranslateConfig struct {
+	Url    string
+	Key    string
+	Source string
+	Batch  bool
+}
+
+// Values used when key is missing in config file created by older version
+func DefaultConfig() Config {
+	return Config{
+		SourceLang:  "auto",
+		Translator:  "gemini",
+		ChunkTokens: 3000,
+		ContextCues: 5,
+		Ass:         defaultAssStyle,
+		Bilingual:   defaultBilingualStyle,
+		OpenAI: OpenAIConfig{
+			Url:   "http://localhost:8080/v1",
+			Model: "gpt-4o-mini",
+		},
+		Ollama: OllamaConfig{
+			Host:    "http://localhost:11434",
+			Model:   "qwen2.5:7b",
+			Context: 8192,
+		},
+		LibreTranslate: LibreTranslateConfig{
+			Url:    "http://localhost:5000",
+			Source: "auto",
+			Batch:  true,
+		},
+		Retry: defaultRetryPolicy,
+		Cache: CacheConfig{MaxSize: 100, MaxAge: 90},
+		Prompt: PromptConfig{
+			Template: defaultPromptTemplate,
+			Metadata: true,
+		},
+		Prices: map[string]ModelPrice{
+			geminiModel: {Input: 0.10, Output: 0.40},
+		},
+	}
+}
+
+func GenerateConfig() {
+	configText := `# Google Gemini API key:
+key = "insert-key-here"
+
+# Your CPU threads
+threads = "8"
+
+# Chose whisper model
+# example: large-v3, medium, small, tiny
+model = "medium"
+
+# Force usage of whisper.cpp version without --cpp argument
+# Enabled by default on Windows regardless of this setting
+cpp = false
+
+# Language spoken in videos (name or ISO 639 code), "auto" lets whisper detect it
+source_lang = "auto"
+
+# Default translation backend: gemini, openai, ollama, libretranslate
+translator = "gemini"
+
+# Max tokens of subtitles sent in one translation request
+# Lower it if translations get cut off, raise it to make less requests
+chunk_tokens = 3000
+
+# Number of previous subtitles with translations sent as context with each request
+context_cues = 5
+
+# Initial prompt for whisper with names, domain vocabulary or punctuation style
+# prompt_file: file with prompt, used instead of prompt when set
+# hotwords: faster-whisper only, appended to prompt with whisper.cpp
+# profile: profile used without --profile argument
+# Profiles override prompt and hotwords, select them with --profile, e.g.:
+# [whisper.profiles.anime]
+# prompt = "Naruto, Sasuke, Kakashi-sensei."
+[whisper]
+prompt = ""
+prompt_file = ""
+hotwords = ""
+profile = ""
+
+# Style of subtitles created with --format ass
+# Colors: "#RRGGBB" or ASS "&HAABBGGRR" (alpha 00 = opaque)
+[ass]
+font = "Arial"
+size = 48
+bold = false
+outline = 2.0
+shadow = 1.0
+primary_color = "#FFFFFF"
+outline_color = "#000000"
+back_color = "&H80000000"
+margin_l = 20
+margin_r = 20
+margin_v = 30
+
+# Style of original lines in subtitles created with --bilingual (ASS and WebVTT only)
+# Scale: font size in percent of translated lines size
+[bilingual]
+styled = true
+color = "#FFFF00"
+scale = 80
+
+# OpenAI-compatible API used with --translator openai
+# e.g. llama.cpp server, vLLM or OpenAI
+[openai]
+url = "http://localhost:8080/v1"
+model = "gpt-4o-mini"
+key = ""
+
+# Local Ollama server used with --translator ollama
+# Context: model context window size, whole conversation must fit in it
+[ollama]
+host = "http://localhost:11434"
+model = "qwen2.5:7b"
+context = 8192
+
+# Self-hosted LibreTranslate server used with --translator libretranslate
+# Source: language code of subtitles or "auto"
+# Batch: send whole chunk in one request instead of one request per cue
+[libretranslate]
+url = "http://localhost:5000"
+key = ""
+source = "auto"
+batch = true
+
+# Retrying failed translation requests with exponential backoff
+# Delays in seconds, delay requested by server is used when available
+[retry]
+max_attempts = 5
+base_delay = 5.0
+max_delay = 120.0
+
+# Limits used by --prune-cache, 0 disables the limit
+# max_size in MB, max_age in days since last use
+[cache]
+max_size = 100
+max_age = 90
+
+# Translation prompt used by gemini, openai and ollama translators
+# Template variables: {{.Lang}} target language, {{.SourceLang}} source language (may be empty), {{.Title}} video title or file name, {{.Genre}} genre set below,
+# {{.Video}} metadata with .Title, .Description, .Uploader and .Tags fields (empty when not available)
+# Instructions about output format are added automatically
+# File: path to file with template, used instead of template when set
+# Glossary: path to file with fixed translations of names and terms, one "source = target" per line,
+# terms below "[language]" line apply only to that language
+# Metadata: fetch title and description with yt-dlp (or ffprobe tags of local files) and use them as context
+[prompt]
+template = '''
+You are a professional subtitles translator. Translate the subtitles you receive into {{.Lang}}.{{if .Genre}} The video genre is {{.Genre}}.{{end}}
+{{with .Video}}
+Information about the video, use it only as context for names and topic:
+Title: {{.Title}}
+{{if .Uploader}}Uploader: {{.Uploader}}
+{{end}}{{if .Tags}}Tags: {{join .Tags ", "}}
+{{end}}{{if .Description}}Description: {{.Description}}
+{{end}}{{end}}'''
+file = ""
+genre = ""
+glossary = ""
+metadata = true
+
+# Prices in USD per million tokens used to estimate translation cost
+# Key is model name, e.g. model from [openai] or [ollama] section
+# Token usage of every run is saved in usage.csv in program folder
+[prices]
+"gemini-2.0-flash" = { input = 0.10, output = 0.40 }
+`
+	if err := os.WriteFile(path.Join(appDir, "config.toml"), []byte(configText), 0644); err != nil {
+		PrintError(err)
+		os.Exit(1)
+	}
+	fmt.Println("Created config file:", path.Join(appDir, "config.toml"))
+}
@@ -1,4 +1,5 @@
 import argparse
+import json
 from faster_whisper import WhisperModel
 
 def format_time(time_in_seconds):
@@ -29,6 +30,10 @@ parser.add_argument('--threads')
 parser.add_argument('--appdir')
 parser.add_argument('--action') # translate or transcribe
 parser.add_argument('--output')
+parser.add_argument('--language') # ISO 639-1 code or auto
+parser.add_argument('--info') # json file with detected language
+parser.add_argument('--prompt') # initial prompt
+parser.add_argument('--hotwords')
 args = parser.parse_args()
 print(args)
 
@@ -43,8 +48,16 @@ threads = int(args.threads)
 # or run on CPU with INT8
 model = WhisperModel(args.model, device="cpu", compute_type="int8", cpu_threads=threads, download_root=args.appdir)
 
-segments, info = model.transcribe(args.input, beam_size=5, task=args.action)
+language = None
+if args.language and args.language != "auto":
+    language = args.language
+
+segments, info = model.transcribe(args.input, beam_size=5, task=args.action, language=language, initial_prompt=args.prompt or None, hotwords=args.hotwords or None)
 print("Detected language '%s' with probability %f." % (info.language, info.language_probability))
 
 save_to_srt(segments, args.output)
 print("Transcription saved to srt file.")
+
+if args.info:
+    with open(args.info, "w") as file:
+        json.dump({"language": info.language, "probability": info.language_probability}, file)
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+const geminiModel = "gemini-2.0-flash"
+
+// Google Gemini translation backend
+type GeminiTranslator struct {
+	client *genai.Client
+	model  *genai.GenerativeModel
+}
+
+func NewGeminiTranslator(ctx context.Context, key string, jsonMode bool) (*GeminiTranslator, error) {
+	client, err := genai.NewClient(ctx, option.WithAPIKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	model := client.GenerativeModel(geminiModel)
+
+	model.SafetySettings = []*genai.SafetySetting{
+		{
+			Category:  genai.HarmCategoryHarassment,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategoryHateSpeech,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategorySexuallyExplicit,
+			Threshold: genai.HarmBlockNone,
+		},
+		{
+			Category:  genai.HarmCategoryDangerousContent,
+			Threshold: genai.HarmBlockNone,
+		},
+	}
+
+	// Model returns array of {id, text} objects, numbers and timings are restored locally
+	if jsonMode {
+		model.ResponseMIMEType = "application/json"
+		model.ResponseSchema = jsonCuesSchema
+	}
+
+	return &GeminiTranslator{client: client, model: model}, nil
+}
+
+func (t *GeminiTranslator) Complete(ctx context.Context, system string, prompt string) (string, Usage, error) {
+	t.model.SystemInstruction = genai.NewUserContent(genai.Text(system))
+	res, err := t.model.GenerateContent(ctx, genai.Text(prompt))
+	if err != nil {
+		return "", Usage{}, geminiAPIError(err)
+	}
+
+	var usage Usage
+	if res.UsageMetadata != nil {
+		usage = Usage{InputTokens: int(res.UsageMetadata.PromptTokenCount), OutputTokens: int(res.UsageMetadata.CandidatesTokenCount)}
+	}
+	text, err := PrintResponse(res)
+	return text, usage, err
+}
+
+func (t *GeminiTranslator) CountTokens(ctx context.Context, text string) (int, error) {
+	res, err := t.model.CountTokens(ctx, genai.Text(text))
+	if err != nil {
+		return 0, err
+	}
+	return int(res.TotalTokens), nil
+}
+
+func (t *GeminiTranslator) Name() string {
+	return "gemini/" + geminiModel
+}
+
+func (t *GeminiTranslator) Close() error {
+	return t.client.Close()
+}
+
+// Converts Gemini API error into APIError with retry delay and quota info from error details,
+// blocked response into IncompleteResponseError
+func geminiAPIError(err error) error {
+	// Safety and recitation finish reasons are returned by client as errors
+	var blocked *genai.BlockedError
+	if errors.As(err, &blocked) {
+		if blocked.Candidate != nil {
+			return &IncompleteResponseError{Reason: strings.TrimPrefix(blocked.Candidate.FinishReason.String(), "FinishReason")}
+		}
+		return &IncompleteResponseError{Reason: "prompt blocked, " + strings.TrimPrefix(blocked.PromptFeedback.BlockReason.String(), "BlockReason")}
+	}
+
+	var gerr *googleapi.Error
+	if !errors.As(err, &gerr) {
+		return err
+	}
+
+	apiErr := &APIError{
+		StatusCode: gerr.Code,
+		Message:    err.Error(),
+		RetryAfter: parseRetryAfter(gerr.Header.Get("Retry-After")),
+	}
+
+	for _, detail := range gerr.Details {
+		fields, ok := detail.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		switch fields["@type"] {
+		case "type.googleapis.com/google.rpc.RetryInfo":
+			if value, ok := fields["retryDelay"].(string); ok {
+				if delay, err := time.ParseDuration(value); err == nil {
+					apiErr.RetryAfter = delay
+				}
+			}
+		case "type.googleapis.com/google.rpc.QuotaFailure":
+			violations, _ := fields["violations"].([]any)
+			for _, violation := range violations {
+				violation, _ := violation.(map[string]any)
+				if quotaId, _ := violation["quotaId"].(string); strings.Contains(quotaId, "PerDay") {
+					apiErr.QuotaExhausted = true
+				}
+			}
+		}
+	}
+
+	if apiErr.QuotaExhausted && apiErr.StatusCode == http.StatusTooManyRequests {
+		apiErr.Message = "daily quota exceeded: " + apiErr.Message
+	}
+	return apiErr
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Translation progress saved after each chunk, allows resuming failed translation.
+// Stored outside of tmp dir because it is cleared on every run.
+type JobState struct {
+	Input string `json:"input"`
+	Lang  string `json:"lang"`
+	// Translated lines by cue index
+	Translations map[int][]string `json:"translations"`
+}
+
+// Job file is identified by source subtitles and translation settings
+func JobPath(cues []Cue, translatorName string, opts TranslateOptions) string {
+	hash := sha256.New()
+	hash.Write([]byte(FormatSRT(cues)))
+	hash.Write([]byte("\n" + translatorName + "\n" + opts.Lang + "\n" + strconv.FormatBool(opts.JSONMode)))
+	hash.Write([]byte("\n" + opts.Prompt + "\n" + opts.Glossary.Instruction()))
+	return path.Join(appDir, "jobs", hex.EncodeToString(hash.Sum(nil))[:16]+".json")
+}
+
+// Returns empty job if file doesn't exist
+func LoadJob(jobPath string, input string, lang string) (*JobState, error) {
+	job := &JobState{Input: input, Lang: lang, Translations: make(map[int][]string)}
+
+	buff, err := os.ReadFile(jobPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return job, nil
+	}
+	if err != nil {
+		return job, err
+	}
+
+	if err := json.Unmarshal(buff, job); err != nil {
+		return &JobState{Input: input, Lang: lang, Translations: make(map[int][]string)}, err
+	}
+	if job.Input != input || job.Lang != lang {
+		return &JobState{Input: input, Lang: lang, Translations: make(map[int][]string)}, errors.New("job file belongs to " + job.Input + " (" + job.Lang + ")")
+	}
+	if job.Translations == nil {
+		job.Translations = make(map[int][]string)
+	}
+	return job, nil
+}
+
+// Writes to temporary file first so interrupted save won't corrupt previous progress
+func (j *JobState) Save(jobPath string) error {
+	if err := os.MkdirAll(path.Dir(jobPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	buff, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(jobPath+".tmp", buff, 0644); err != nil {
+		return err
+	}
+	return os.Rename(jobPath+".tmp", jobPath)
+}
+
+// Returns translated chunk if all of its cues were translated before
+func (j *JobState) Translated(chunk []Cue) ([]Cue, bool) {
+	translated := make([]Cue, len(chunk))
+	for i, cue := range chunk {
+		lines, ok := j.Translations[cue.Index]
+		if !ok {
+			return nil, false
+		}
+		cue.Lines = lines
+		cue.Original = nil
+		translated[i] = cue
+	}
+	return translated, true
+}
+
+// Failed cues are skipped, so their chunk is translated again after resume
+func (j *JobState) Add(translated []Cue, failed []FailedCue) {
+	skip := make(map[int]bool)
+	for _, cue := range failed {
+		skip[cue.Index] = true
+	}
+	for _, cue := range translated {
+		if !skip[cue.Index] {
+			j.Translations[cue.Index] = cue.Lines
+		}
+	}
+}
+
+// Transcription of unfinished translation, whisper can transcribe differently on rerun
+// and job files wouldn't match new subtitles
+type TranscriptionJob struct {
+	Input   string          `json:"input"`
+	Langs   []string        `json:"langs"`
+	Whisper WhisperSettings `json:"whisper"`
+	// Source language set by user or detected by whisper, empty if unknown
+	SourceLang string `json:"source_lang"`
+	// Transcription in SRT format
+	Subtitles string `json:"subtitles"`
+}
+
+// Whisper settings of saved transcription, rerun with different settings transcribes again
+type WhisperSettings struct {
+	// faster-whisper or whisper.cpp
+	Backend string `json:"backend"`
+	Model   string `json:"model"`
+	// Language passed to whisper, "auto" for detection
+	Language string `json:"language"`
+	Prompt   string `json:"prompt"`
+	Hotwords string `json:"hotwords"`
+}
+
+// Transcription job file is identified by input, translation languages and whisper settings
+func TranscriptionJobPath(input string, langs []Language, settings WhisperSettings) string {
+	hash := sha256.New()
+	hash.Write([]byte(input + "\n" + strings.Join(LanguageNames(langs), ",")))
+	hash.Write([]byte("\n" + settings.Backend + "\n" + settings.Model + "\n" + settings.Language + "\n" + settings.Prompt + "\n" + settings.Hotwords))
+	return path.Join(appDir, "jobs", hex.EncodeToString(hash.Sum(nil))[:16]+".transcription.json")
+}
+
+// Returns nil if file doesn't exist
+func LoadTranscriptionJob(jobPath string, input string, langs []Language, settings WhisperSettings) (*TranscriptionJob, error) {
+	buff, err := os.ReadFile(jobPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var job TranscriptionJob
+	if err := json.Unmarshal(buff, &job); err != nil {
+		return nil, err
+	}
+	if job.Input != input || !slices.Equal(job.Langs, LanguageNames(langs)) {
+		return nil, errors.New("transcription job file belongs to " + job.Input + " (" + strings.Join(job.Langs, ", ") + ")")
+	}
+	if job.Whisper != settings {
+		return nil, errors.New("transcription job file was created with different whisper settings")
+	}
+	return &job, nil
+}
+
+// Writes to temporary file first so interrupted save won't corrupt previous transcription
+func (j *TranscriptionJob) Save(jobPath string) error {
+	if err := os.MkdirAll(path.Dir(jobPath), os.ModePerm); err != nil {
+		return err
+	}
+
+	buff, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(jobPath+".tmp", buff, 0644); err != nil {
+		return err
+	}
+	return os.Rename(jobPath+".tmp", jobPath)
+}
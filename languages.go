@@ -0,0 +1,147 @@
+package main
+
+import "strings"
+
+// Language accepted by --lang, found by name or ISO 639 code
+type Language struct {
+	// English name passed to translator
+	Name string
+	// ISO 639-1, used in file names and by LibreTranslate
+	Code string
+	// ISO 639-2/B, used in track metadata of mkv files
+	Code3 string
+	// ISO 639-2/T when different from 639-2/B
+	Code3T string
+}
+
+var languages = []Language{
+	{Name: "Afrikaans", Code: "af", Code3: "afr"},
+	{Name: "Albanian", Code: "sq", Code3: "alb", Code3T: "sqi"},
+	{Name: "Arabic", Code: "ar", Code3: "ara"},
+	{Name: "Armenian", Code: "hy", Code3: "arm", Code3T: "hye"},
+	{Name: "Azerbaijani", Code: "az", Code3: "aze"},
+	{Name: "Basque", Code: "eu", Code3: "baq", Code3T: "eus"},
+	{Name: "Belarusian", Code: "be", Code3: "bel"},
+	{Name: "Bengali", Code: "bn", Code3: "ben"},
+	{Name: "Bosnian", Code: "bs", Code3: "bos"},
+	{Name: "Bulgarian", Code: "bg", Code3: "bul"},
+	{Name: "Catalan", Code: "ca", Code3: "cat"},
+	{Name: "Chinese", Code: "zh", Code3: "chi", Code3T: "zho"},
+	{Name: "Croatian", Code: "hr", Code3: "hrv"},
+	{Name: "Czech", Code: "cs", Code3: "cze", Code3T: "ces"},
+	{Name: "Danish", Code: "da", Code3: "dan"},
+	{Name: "Dutch", Code: "nl", Code3: "dut", Code3T: "nld"},
+	{Name: "English", Code: "en", Code3: "eng"},
+	{Name: "Esperanto", Code: "eo", Code3: "epo"},
+	{Name: "Estonian", Code: "et", Code3: "est"},
+	// Filipino has no ISO 639-1 code, "tl" is Tagalog
+	{Name: "Filipino", Code3: "fil"},
+	{Name: "Finnish", Code: "fi", Code3: "fin"},
+	{Name: "French", Code: "fr", Code3: "fre", Code3T: "fra"},
+	{Name: "Galician", Code: "gl", Code3: "glg"},
+	{Name: "Georgian", Code: "ka", Code3: "geo", Code3T: "kat"},
+	{Name: "German", Code: "de", Code3: "ger", Code3T: "deu"},
+	{Name: "Greek", Code: "el", Code3: "gre", Code3T: "ell"},
+	{Name: "Gujarati", Code: "gu", Code3: "guj"},
+	{Name: "Hebrew", Code: "he", Code3: "heb"},
+	{Name: "Hindi", Code: "hi", Code3: "hin"},
+	{Name: "Hungarian", Code: "hu", Code3: "hun"},
+	{Name: "Icelandic", Code: "is", Code3: "ice", Code3T: "isl"},
+	{Name: "Indonesian", Code: "id", Code3: "ind"},
+	{Name: "Irish", Code: "ga", Code3: "gle"},
+	{Name: "Italian", Code: "it", Code3: "ita"},
+	{Name: "Japanese", Code: "ja", Code3: "jpn"},
+	{Name: "Kannada", Code: "kn", Code3: "kan"},
+	{Name: "Kazakh", Code: "kk", Code3: "kaz"},
+	{Name: "Korean", Code: "ko", Code3: "kor"},
+	{Name: "Latvian", Code: "lv", Code3: "lav"},
+	{Name: "Lithuanian", Code: "lt", Code3: "lit"},
+	{Name: "Macedonian", Code: "mk", Code3: "mac", Code3T: "mkd"},
+	{Name: "Malay", Code: "ms", Code3: "may", Code3T: "msa"},
+	{Name: "Malayalam", Code: "ml", Code3: "mal"},
+	{Name: "Marathi", Code: "mr", Code3: "mar"},
+	{Name: "Mongolian", Code: "mn", Code3: "mon"},
+	{Name: "Nepali", Code: "ne", Code3: "nep"},
+	{Name: "Norwegian", Code: "no", Code3: "nor"},
+	{Name: "Persian", Code: "fa", Code3: "per", Code3T: "fas"},
+	{Name: "Polish", Code: "pl", Code3: "pol"},
+	{Name: "Portuguese", Code: "pt", Code3: "por"},
+	{Name: "Punjabi", Code: "pa", Code3: "pan"},
+	{Name: "Romanian", Code: "ro", Code3: "rum", Code3T: "ron"},
+	{Name: "Russian", Code: "ru", Code3: "rus"},
+	{Name: "Serbian", Code: "sr", Code3: "srp"},
+	{Name: "Slovak", Code: "sk", Code3: "slo", Code3T: "slk"},
+	{Name: "Slovenian", Code: "sl", Code3: "slv"},
+	{Name: "Spanish", Code: "es", Code3: "spa"},
+	{Name: "Swahili", Code: "sw", Code3: "swa"},
+	{Name: "Swedish", Code: "sv", Code3: "swe"},
+	{Name: "Tagalog", Code: "tl", Code3: "tgl"},
+	{Name: "Tamil", Code: "ta", Code3: "tam"},
+	{Name: "Telugu", Code: "te", Code3: "tel"},
+	{Name: "Thai", Code: "th", Code3: "tha"},
+	{Name: "Turkish", Code: "tr", Code3: "tur"},
+	{Name: "Ukrainian", Code: "uk", Code3: "ukr"},
+	{Name: "Urdu", Code: "ur", Code3: "urd"},
+	{Name: "Uzbek", Code: "uz", Code3: "uzb"},
+	{Name: "Vietnamese", Code: "vi", Code3: "vie"},
+	{Name: "Welsh", Code: "cy", Code3: "wel", Code3T: "cym"},
+}
+
+// Finds language by English name, ISO 639-1 or ISO 639-2 code, case insensitive
+func FindLanguage(value string) (Language, bool) {
+	value = strings.TrimSpace(value)
+	for _, lang := range languages {
+		if strings.EqualFold(value, lang.Name) || strings.EqualFold(value, lang.Code) ||
+			strings.EqualFold(value, lang.Code3) || (lang.Code3T != "" && strings.EqualFold(value, lang.Code3T)) {
+			return lang, true
+		}
+	}
+	return Language{}, false
+}
+
+// Value looks like ISO 639 code, e.g. "jw" or "haw"
+func isLanguageCode(value string) bool {
+	if len(value) < 2 || len(value) > 3 {
+		return false
+	}
+	for _, r := range value {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns registered language or language with only name, e.g. "Brazilian Portuguese",
+// which is passed to translator as it is
+func ParseLanguage(value string) Language {
+	if lang, ok := FindLanguage(value); ok {
+		return lang
+	}
+	return Language{Name: strings.TrimSpace(value)}
+}
+
+// Same language name or code
+func (l Language) Matches(value string) bool {
+	if strings.EqualFold(strings.TrimSpace(value), l.Name) {
+		return true
+	}
+	lang, ok := FindLanguage(value)
+	return ok && l.Code3 != "" && lang.Code3 == l.Code3
+}
+
+// Code used in file names, name when language has no code
+func (l Language) FileCode() string {
+	if l.Code != "" {
+		return l.Code
+	}
+	return l.Name
+}
+
+// ISO 639-2 code for track metadata, "und" (undetermined) when language is unknown
+func (l Language) TrackCode() string {
+	if l.Code3 != "" {
+		return l.Code3
+	}
+	return "und"
+}
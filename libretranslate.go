@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Machine translation backend for self-hosted LibreTranslate (Argos Translate) server
+type LibreTranslator struct {
+	config LibreTranslateConfig
+}
+
+type libreTranslateRequest struct {
+	Q      any    `json:"q"`
+	Source string `json:"source"`
+	Target string `json:"target"`
+	Format string `json:"format"`
+	ApiKey string `json:"api_key,omitempty"`
+}
+
+func NewLibreTranslator(config LibreTranslateConfig) *LibreTranslator {
+	return &LibreTranslator{config: config}
+}
+
+func (t *LibreTranslator) TranslateTexts(ctx context.Context, texts []string, lang string) ([]string, error) {
+	// LibreTranslate expects language codes, translators get language names
+	target := strings.ToLower(lang)
+	if language, ok := FindLanguage(lang); ok && language.Code != "" {
+		target = language.Code
+	}
+
+	if t.config.Batch {
+		var translations []string
+		if err := t.request(ctx, texts, target, &translations); err != nil {
+			return nil, err
+		}
+		return translations, nil
+	}
+
+	translations := make([]string, len(texts))
+	for i, text := range texts {
+		if err := t.request(ctx, text, target, &translations[i]); err != nil {
+			return nil, err
+		}
+	}
+	return translations, nil
+}
+
+// Sends single text or array of texts, result is decoded into translatedText of the same type
+func (t *LibreTranslator) request(ctx context.Context, q any, target string, result any) error {
+	body, err := json.Marshal(libreTranslateRequest{
+		Q:      q,
+		Source: t.config.Source,
+		Target: target,
+		Format: "text",
+		ApiKey: t.config.Key,
+	})
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(t.config.Url, "/") + "/translate"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return NewHTTPError(resp, respBody)
+	}
+
+	res := struct {
+		TranslatedText any `json:"translatedText"`
+	}{TranslatedText: result}
+	return json.Unmarshal(respBody, &res)
+}
+
+func (t *LibreTranslator) Name() string {
+	return "libretranslate/" + t.config.Url + "/" + t.config.Source
+}
+
+func (t *LibreTranslator) Close() error {
+	return nil
+}
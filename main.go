@@ -7,16 +7,15 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"os/exec"
 	"path"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/BurntSushi/toml"
-	"github.com/google/generative-ai-go/genai"
 	"github.com/leaanthony/spinner"
-	"google.golang.org/api/option"
 )
 
 //go:embed embed
@@ -26,6 +25,7 @@ var (
 	appDir            string
 	debugMode         bool
 	verboseMode       bool
+	dryRunMode        bool
 	commandCurrentDir bool
 )
 
@@ -51,10 +51,26 @@ func main() {
 	ytdlpFlag := flag.Bool("ytdlp", false, "Download remote video using yt-dlp")
 	verboseFlag := flag.Bool("verbose", false, "Print commands output in stdout")
 	debugFlag := flag.Bool("debug", false, "Print debug info in stdout")
-	geminiFlag := flag.Bool("gemini", false, "Translate using Google Gemini instead of Whisper")
-	langFlag := flag.String("lang", "english", "Specifies a target translation language when using Google Gemini")
+	geminiFlag := flag.Bool("gemini", false, "Translate using Google Gemini (or translator set in config file) instead of Whisper")
+	langFlag := flag.String("lang", "english", "Specifies a target translation language (name or ISO 639 code) when using Google Gemini, multiple languages separated by commas")
 	cppFlag := flag.Bool("cpp", false, "Transcribe using whisper.cpp instead of faster-whisper (enabled by default on Windows)")
+	sourceLangFlag := flag.String("source-lang", "", "Language spoken in video (name or ISO 639 code), detected by whisper when not set (default from config file)")
+	promptFlag := flag.String("prompt", "", "Initial prompt for whisper with names and vocabulary (default from config file)")
+	promptFileFlag := flag.String("prompt-file", "", "File with initial prompt for whisper")
+	profileFlag := flag.String("profile", "", "Whisper prompt profile from config file")
 	modelFlag := flag.String("model", "", "Chose whisper model")
+	formatFlag := flag.String("format", "srt", "Output subtitles format: srt, vtt, ass")
+	jsonFlag := flag.Bool("json", false, "Send only subtitles text to translator as JSON instead of full SRT subtitles")
+	translatorFlag := flag.String("translator", "", "Translate using chosen backend: gemini, openai, ollama, libretranslate (default from config file)")
+	noCacheFlag := flag.Bool("no-cache", false, "Don't use translations cached in previous runs")
+	pruneCacheFlag := flag.Bool("prune-cache", false, "Remove old translation cache entries using limits from config file")
+	glossaryFlag := flag.String("glossary", "", "File with fixed translations of names and terms (default from config file)")
+	genreFlag := flag.String("genre", "", "Video genre available in translation prompt (default from config file)")
+	noMetadataFlag := flag.Bool("no-metadata", false, "Don't use video title and description as translation context")
+	strictFlag := flag.Bool("strict", false, "Exit with error code when quality check finds suspicious translated subtitles")
+	refineFlag := flag.Bool("refine", false, "Review translation in second pass and save list of changes next to output file")
+	dryRunFlag := flag.Bool("dry-run", false, "Print commands, translation requests and output files without running anything")
+	bilingualFlag := flag.Bool("bilingual", false, "Show original line above translated line in a single subtitles file (requires --gemini)")
 	flag.Parse()
 
 	if *debugFlag {
@@ -63,11 +79,6 @@ func main() {
 	if *verboseFlag {
 		verboseMode = true
 	}
-	action := "translate"
-	if *geminiFlag {
-		action = "transcribe"
-	}
-
 	// Detect OS and set OS specific variables
 	var whisperCppFile string
 	if runtime.GOOS == "windows" {
@@ -195,13 +206,7 @@ func main() {
 	}
 
 	// Load config file
-	type Config struct {
-		Key     string
-		Threads string
-		Model   string
-		Cpp     bool
-	}
-	var config Config
+	config := DefaultConfig()
 	if _, err := toml.DecodeFile(path.Join(appDir, "config.toml"), &config); err != nil {
 		fmt.Println("Config file error.")
 		PrintError(err)
@@ -211,6 +216,19 @@ func main() {
 	DebugLog("cpu threads:", config.Threads)
 	DebugLog("whisper model:", config.Model)
 	DebugLog("------------------------")
+	assStyle = config.Ass
+	bilingualStyle = config.Bilingual
+
+	// --prune-cache
+	if *pruneCacheFlag {
+		removed, freed, err := PruneCache(path.Join(appDir, "cache"), int64(config.Cache.MaxSize)*1024*1024, time.Duration(config.Cache.MaxAge)*24*time.Hour)
+		if err != nil {
+			PrintError(err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %d cache entries (%.1f MB).\n", removed, float64(freed)/1024/1024)
+		os.Exit(0)
+	}
 
 	if len(flag.Args()) < 1 {
 		fmt.Println("Usage: sasayaki [args] <url>")
@@ -218,16 +236,136 @@ func main() {
 		os.Exit(0)
 	}
 
-	if (config.Key == "insert-key-here") && *geminiFlag {
+	// --translator enables translation same as --gemini
+	if *translatorFlag != "" {
+		*geminiFlag = true
+	} else {
+		*translatorFlag = config.Translator
+	}
+	if _, ok := translatorNames[*translatorFlag]; !ok {
+		PrintError(errors.New("Unsupported translator: " + *translatorFlag))
+		os.Exit(1)
+	}
+
+	// Whisper translates into English only when no translator is used
+	action := "translate"
+	if *geminiFlag {
+		action = "transcribe"
+	}
+
+	if (config.Key == "insert-key-here") && *geminiFlag && *translatorFlag == "gemini" {
 		PrintError(errors.New("Missing Google Gemini API key in config file."))
 		fmt.Println("Config file location:", path.Join(appDir, "config.toml"))
 		os.Exit(1)
 	}
 
+	if config.Retry.MaxAttempts <= 0 {
+		config.Retry.MaxAttempts = 1
+	}
+
+	if len(ParseLangs(*langFlag)) == 0 {
+		PrintError(errors.New("Missing translation language."))
+		os.Exit(1)
+	}
+	for _, lang := range ParseLangs(*langFlag) {
+		if _, ok := FindLanguage(lang.Name); !ok && *geminiFlag {
+			fmt.Println("Unknown language \"" + lang.Name + "\", it will be passed to translator as it is and tagged as undetermined.")
+		}
+	}
+
+	// Translation prompt and glossary
+	if *glossaryFlag != "" {
+		config.Prompt.Glossary = *glossaryFlag
+	}
+	if *noMetadataFlag {
+		config.Prompt.Metadata = false
+	}
+	if *genreFlag != "" {
+		config.Prompt.Genre = *genreFlag
+	}
+	promptTemplate, err := LoadPromptTemplate(config.Prompt)
+	if err != nil {
+		fmt.Println("Prompt template error.")
+		PrintError(err)
+		os.Exit(1)
+	}
+	// Subtitles input is always translated, even without --gemini
+	_, isSubtitlesInput := SubtitlesFormatFromPath(flag.Args()[0])
+	var glossary Glossary
+	if config.Prompt.Glossary != "" && (*geminiFlag || isSubtitlesInput) {
+		glossary, err = LoadGlossary(config.Prompt.Glossary)
+		if err != nil {
+			fmt.Println("Glossary error.")
+			PrintError(err)
+			os.Exit(1)
+		}
+		DebugLog("Glossary terms:", len(glossary))
+	}
+
+	if config.ChunkTokens <= 0 {
+		PrintError(errors.New("chunk_tokens in config file must be greater than 0."))
+		os.Exit(1)
+	}
+
+	if _, ok := subtitleCodecs[*formatFlag]; !ok {
+		PrintError(errors.New("Unsupported subtitles format: " + *formatFlag))
+		os.Exit(1)
+	}
+
+	if *refineFlag && *translatorFlag == "libretranslate" {
+		PrintError(errors.New("--refine requires chat translator: gemini, openai or ollama."))
+		os.Exit(1)
+	}
+
+	if *bilingualFlag && !*geminiFlag && !isSubtitlesInput {
+		PrintError(errors.New("--bilingual requires translation using --gemini."))
+		os.Exit(1)
+	}
+
 	if *modelFlag != "" {
 		config.Model = *modelFlag
 	}
 
+	// Source language, whisper accepts only ISO 639-1 codes
+	if *sourceLangFlag != "" {
+		config.SourceLang = *sourceLangFlag
+	}
+	var sourceLang Language
+	if config.SourceLang != "" && config.SourceLang != "auto" {
+		lang, ok := FindLanguage(config.SourceLang)
+		// Whisper knows more languages than registry, e.g. yue or haw
+		if !ok && isLanguageCode(config.SourceLang) {
+			fmt.Println("Unknown source language \"" + config.SourceLang + "\", it will be passed to whisper as it is and tagged as undetermined.")
+			lang, ok = Language{Name: config.SourceLang, Code: strings.ToLower(config.SourceLang)}, true
+		}
+		if !ok {
+			PrintError(errors.New("Unsupported source language: " + config.SourceLang))
+			os.Exit(1)
+		}
+		if lang.Code == "" {
+			PrintError(errors.New("Whisper has no code for " + lang.Name + ", use --source-lang auto."))
+			os.Exit(1)
+		}
+		sourceLang = lang
+	}
+	whisperLang := "auto"
+	if sourceLang.Code != "" {
+		whisperLang = sourceLang.Code
+	}
+
+	// Whisper initial prompt, arguments override config file and profile
+	whisperPrompt, whisperHotwords, err := ResolveWhisperPrompt(config.Whisper, *profileFlag)
+	if err == nil && (*promptFlag != "" || *promptFileFlag != "") {
+		whisperPrompt, _, err = ResolveWhisperPrompt(WhisperConfig{WhisperPrompt: WhisperPrompt{Prompt: *promptFlag, PromptFile: *promptFileFlag}}, "")
+	}
+	if err != nil {
+		fmt.Println("Whisper prompt error.")
+		PrintError(err)
+		os.Exit(1)
+	}
+	DebugLog("Whisper prompt:", whisperPrompt)
+	DebugLog("Whisper hotwords:", whisperHotwords)
+
 	if config.Cpp {
 		*cppFlag = true
 	}
@@ -240,12 +378,20 @@ func main() {
 		}
 	}
 
+	if *dryRunFlag {
+		dryRunMode = true
+		fmt.Println("Dry run, nothing will be downloaded, executed or translated.")
+		fmt.Println("")
+	}
+
 	// Download whisper.cpp model if --cpp enabled
 	if *cppFlag {
 		modelName := "ggml-" + config.Model + ".bin"
 		modelPath := path.Join(appDir, "models", modelName)
 
-		if !FileExists(modelPath) {
+		if !FileExists(modelPath) && dryRunMode {
+			PrintPlan("Downloading whisper.cpp model ("+modelName+").", "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/"+modelName, "-> "+modelPath)
+		} else if !FileExists(modelPath) {
 			myspinner := spinner.New()
 			myspinner.Start("Downloading whisper.cpp model (" + modelName + ").")
 
@@ -260,15 +406,17 @@ func main() {
 	}
 
 	// Clear tmp dir
-	if err := os.RemoveAll(path.Join(appDir, "tmp")); err != nil {
-		PrintError(err)
-		os.Exit(1)
-	}
-	if err := os.MkdirAll(path.Join(appDir, "tmp"), os.ModePerm); err != nil {
-		PrintError(err)
-		os.Exit(1)
+	if !dryRunMode {
+		if err := os.RemoveAll(path.Join(appDir, "tmp")); err != nil {
+			PrintError(err)
+			os.Exit(1)
+		}
+		if err := os.MkdirAll(path.Join(appDir, "tmp"), os.ModePerm); err != nil {
+			PrintError(err)
+			os.Exit(1)
+		}
+		DebugLog("Cleared dir:", path.Join(appDir, "tmp"))
 	}
-	DebugLog("Cleared dir:", path.Join(appDir, "tmp"))
 
 	url := flag.Args()[0]
 
@@ -277,13 +425,14 @@ func main() {
 		videoInput          string
 		videoOutput         string // only if downloading video with yt-dlp
 		videoTmp            string // --ytdlp, tmp video file awaiting for translated subs
-		srtInput            string // only if translating .srt transcription file again
+		srtInput            string // only if translating .srt or .vtt transcription file again
 		srtTmp              string // tmp file from python script, might be transcription or translation
-		srtTranslatedTmp    string // tmp file from Google Gemini, might be only translation
 		srtOutput           string // output file with transcription
 		srtTranslatedOutput string // output file with translated subtitles
 		outputDir           string // generated files final destination
 		fileName            string // name of input file without exctension
+		videoMetadata       *VideoMetadata
+		videoDuration       time.Duration // only used by --dry-run
 	)
 
 	// Auto detect if url is a link
@@ -295,20 +444,17 @@ func main() {
 	// Download video
 	if *ytdlpFlag {
 		ytdlpNameTemplate := "%(title).150B%(title.151B&…|)s [%(display_id)s].%(ext)s"
-		cmd := exec.Command("yt-dlp", "--windows-filenames", "--remux-video", "mkv", "-o", ytdlpNameTemplate, "--print", "filename", url)
-
-		// Tmp fix for Windows cmd output not in utf-8
-		if runtime.GOOS == "windows" {
-			cmd.Args = append(cmd.Args, "--restrict-filenames")
-		}
-
-		output, err := cmd.CombinedOutput()
+		metadata, ytdlpName, err := FetchYtdlpMetadata(url, ytdlpNameTemplate)
 		if err != nil {
 			fmt.Println("yt-dlp error.")
 			PrintError(err)
 			os.Exit(1)
 		}
-		ytdlpName := path.Base(strings.TrimSpace(string(output)))
+		if config.Prompt.Metadata {
+			videoMetadata = metadata
+		}
+		videoDuration = time.Duration(metadata.Duration * float64(time.Second))
+		ytdlpName = path.Base(ytdlpName)
 		ytdlpName = strings.TrimSuffix(path.Base(ytdlpName), path.Ext(ytdlpName))
 		ytdlpName = ytdlpName + ".mkv"
 		videoTmp = path.Join(appDir, "tmp", ytdlpName)
@@ -319,7 +465,7 @@ func main() {
 
 	// Define file names and paths
 	isSrtInput := false
-	if path.Ext(url) == ".srt" {
+	if _, ok := SubtitlesFormatFromPath(url); ok {
 		isSrtInput = true
 		*geminiFlag = true
 		srtInput = url
@@ -332,11 +478,88 @@ func main() {
 		fileName = strings.TrimSuffix(path.Base(videoInput), path.Ext(videoInput))
 	}
 	srtTmp = path.Join(appDir, "tmp", fileName+" (transcription).srt")
+
+	// Job files of local input are identified by absolute path, command can be run again from other dir
+	jobInput := url
+	if !*ytdlpFlag {
+		if absPath, err := filepath.Abs(url); err == nil {
+			jobInput = absPath
+		}
+	}
+
+	// Set to 1 by failed quality check with --strict, files are still created
+	exitCode := 0
+
+	// Each language is translated from the same transcription
+	langs := ParseLangs(*langFlag)
+	translatedTmps := make([]string, len(langs))
+	for i, lang := range langs {
+		translatedTmps[i] = path.Join(appDir, "tmp", LangFileName(fileName, langs, lang)+".srt")
+	}
+
+	// Output files
+	if *ytdlpFlag {
+		outputDir = currentDir
+	} else if isSrtInput {
+		outputDir = path.Dir(srtInput)
+	} else {
+		outputDir = path.Dir(videoInput)
+	}
+
+	srtOutput = path.Join(outputDir, fileName+" (transcription)."+*formatFlag)
+	srtTranslatedOutput = path.Join(outputDir, fileName+"."+*formatFlag)
+	videoOutput = path.Join(outputDir, fileName+".mkv")
+	translatedOutputs := make([]string, len(langs))
+	for i, lang := range langs {
+		translatedOutputs[i] = path.Join(outputDir, LangFileName(fileName, langs, lang)+"."+*formatFlag)
+	}
+
+	// Tags of local file are used as translation context
+	if !*ytdlpFlag && !isSrtInput && *geminiFlag && config.Prompt.Metadata {
+		metadata, err := ProbeMetadata(videoInput)
+		if err != nil {
+			DebugLog("Couldn't read file metadata:", err)
+		}
+		videoMetadata = metadata
+	}
+	if videoMetadata != nil {
+		DebugLog("Video title:", videoMetadata.Title)
+	}
 	nameForCppExecutable := path.Join(appDir, "tmp", fileName+" (transcription)") // without extension
-	srtTranslatedTmp = path.Join(appDir, "tmp", fileName+".srt")
+
+	// Transcription saved by previous failed translation is reused, so translation can be resumed
+	var transcriptionJobPath string
+	var transcriptionJob *TranscriptionJob
+	whisperSettings := WhisperSettings{Backend: "faster-whisper", Model: config.Model, Language: whisperLang, Prompt: whisperPrompt, Hotwords: whisperHotwords}
+	if *cppFlag {
+		whisperSettings.Backend = "whisper.cpp"
+	}
+	if !isSrtInput && *geminiFlag {
+		transcriptionJobPath = TranscriptionJobPath(jobInput, langs, whisperSettings)
+		transcriptionJob, err = LoadTranscriptionJob(transcriptionJobPath, jobInput, langs, whisperSettings)
+		if err != nil {
+			DebugLog("Couldn't load transcription job file, transcribing again:", err)
+		}
+	}
+	if transcriptionJob != nil {
+		if dryRunMode {
+			PrintPlan("Using transcription saved by previous run.", transcriptionJobPath)
+		} else {
+			fmt.Println("Using transcription saved by previous run.")
+			if err := os.WriteFile(srtTmp, []byte(transcriptionJob.Subtitles), 0644); err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+			DebugLog("Created file:", srtTmp)
+		}
+		if sourceLang.Name == "" && transcriptionJob.SourceLang != "" {
+			sourceLang = ParseLanguage(transcriptionJob.SourceLang)
+		}
+	}
 
 	// Start transcription
-	if path.Ext(url) != ".srt" {
+	var infoFile string // detected language saved by whisper
+	if !isSrtInput && transcriptionJob == nil {
 		audioFile := path.Join(appDir, "tmp", "audio.wav")
 		// ffmpeg -i <video> -ar 16000 -ac 1 -c:a pcm_s16le output.wav
 		RunCommand("Extracting audio from video file.", "ffmpeg", "-y", "-i", videoInput, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", audioFile)
@@ -347,214 +570,490 @@ func main() {
 				translate = "true"
 			}
 
-			// TODO: --prompt
-			RunCommand("Transcription using whisper.cpp.", path.Join(appDir, whisperCppFile), "--threads", config.Threads, "--translate", translate, "--output-srt", "--output-file", nameForCppExecutable, "--language", "auto", "--model", path.Join(appDir, "models", "ggml-"+config.Model+".bin"), "--file", audioFile)
+			args := []string{path.Join(appDir, whisperCppFile), "--threads", config.Threads, "--translate", translate, "--output-srt", "--output-json", "--output-file", nameForCppExecutable, "--language", whisperLang, "--model", path.Join(appDir, "models", "ggml-"+config.Model+".bin"), "--file", audioFile}
+			// whisper.cpp has no hotwords, they are added to prompt
+			if prompt := strings.TrimSpace(whisperPrompt + " " + whisperHotwords); prompt != "" {
+				args = append(args, "--prompt", prompt)
+			}
+			RunCommand("Transcription using whisper.cpp.", args...)
+			infoFile = nameForCppExecutable + ".json"
 		} else {
-			RunCommand("Transcription using faster-whisper.", path.Join(appDir, "whisper-env", "bin", "python"), path.Join(appDir, "transcribe.py"), "--output", srtTmp, "--model", config.Model, "--threads", config.Threads, "--appdir", path.Join(appDir, "models"), "--action", action, "--input", audioFile)
+			if dryRunMode && !FasterWhisperModelExists(path.Join(appDir, "models"), config.Model) {
+				PrintPlan("Downloading faster-whisper model ("+config.Model+").", "Model will be downloaded by faster-whisper into "+path.Join(appDir, "models"))
+			}
+			args := []string{path.Join(appDir, "whisper-env", "bin", "python"), path.Join(appDir, "transcribe.py"), "--output", srtTmp, "--model", config.Model, "--threads", config.Threads, "--appdir", path.Join(appDir, "models"), "--action", action, "--input", audioFile}
+			if ScriptSupports(path.Join(appDir, "transcribe.py"), "--language") {
+				infoFile = path.Join(appDir, "tmp", "transcription.json")
+				args = append(args, "--language", whisperLang, "--info", infoFile)
+			} else if whisperLang != "auto" {
+				fmt.Println("TIP: transcribe.py is outdated and doesn't support --source-lang, update it using --install argument.")
+			}
+			if ScriptSupports(path.Join(appDir, "transcribe.py"), "--prompt") {
+				if whisperPrompt != "" {
+					args = append(args, "--prompt", whisperPrompt)
+				}
+				if whisperHotwords != "" {
+					args = append(args, "--hotwords", whisperHotwords)
+				}
+			} else if whisperPrompt != "" || whisperHotwords != "" {
+				fmt.Println("TIP: transcribe.py is outdated and doesn't support whisper prompt, update it using --install argument.")
+			}
+			RunCommand("Transcription using faster-whisper.", args...)
 		}
-		DebugLog("Created file:", srtTmp)
+		if !dryRunMode {
+			DebugLog("Created file:", srtTmp)
 
-		DebugLog("Deleting file:", audioFile)
-		os.Remove(audioFile)
+			DebugLog("Deleting file:", audioFile)
+			os.Remove(audioFile)
+		}
 	}
 
-	// Load .srt file
-	var fileToRead string
-	if isSrtInput {
-		fileToRead = srtInput
-	} else {
-		fileToRead = srtTmp
+	// Language detected by whisper is used when source language is not set
+	if infoFile != "" && !dryRunMode {
+		var info *TranscriptionInfo
+		var err error
+		if *cppFlag {
+			info, err = ReadWhisperCppInfo(infoFile)
+		} else {
+			info, err = ReadTranscriptionInfo(infoFile)
+		}
+		if err != nil {
+			DebugLog("Couldn't read detected language:", err)
+		} else if info.Language != "" {
+			detected := ParseLanguage(info.Language)
+			message := "Detected language: " + detected.Name
+			if info.Probability > 0 {
+				message += fmt.Sprintf(" (%.0f%%)", info.Probability*100)
+			}
+			fmt.Println(message + ".")
+			if sourceLang.Name == "" {
+				sourceLang = detected
+			}
+		}
+		DebugLog("Deleting file:", infoFile)
+		os.Remove(infoFile)
 	}
 
-	transcriptionBuff, err := os.ReadFile(fileToRead)
-	if err != nil {
-		PrintError(err)
-		os.Exit(1)
+	// Saved until all languages are translated
+	if transcriptionJobPath != "" && transcriptionJob == nil && !dryRunMode {
+		buff, err := os.ReadFile(srtTmp)
+		if err == nil {
+			job := TranscriptionJob{Input: jobInput, Langs: LanguageNames(langs), Whisper: whisperSettings, SourceLang: sourceLang.FileCode(), Subtitles: string(buff)}
+			err = job.Save(transcriptionJobPath)
+		}
+		if err != nil {
+			DebugLog("Couldn't save transcription job file:", err)
+		}
 	}
-	transcription := string(transcriptionBuff)
 
-	if *geminiFlag {
-		// Init Gemini model
-		myspinner := spinner.New()
-		if verboseMode {
-			fmt.Println("Translation using Google Gemini AI.")
+	// --dry-run ends here, translation and output files are only described
+	if dryRunMode {
+		var planCues []Cue
+		if isSrtInput {
+			planCues, err = ReadSubtitlesFile(srtInput)
+			if err != nil {
+				fmt.Println("Subtitles parsing error:", srtInput)
+				PrintError(err)
+				os.Exit(1)
+			}
+		} else if videoDuration == 0 && !*ytdlpFlag {
+			videoDuration, err = ProbeDuration(videoInput)
+			if err != nil {
+				DebugLog("Couldn't read media duration:", err)
+			}
+		}
+
+		if *geminiFlag {
+			details := []string{"Languages: " + strings.Join(LanguageNames(langs), ", ")}
+			requests, tokens, ok := EstimateTranslation(planCues, videoDuration, config.ChunkTokens)
+			if ok {
+				details = append(details,
+					fmt.Sprintf("Requests: %d per language, %d in total", requests, requests*len(langs)),
+					fmt.Sprintf("Estimated subtitles tokens: %d per language, %d in total (without prompt and context)", tokens, tokens*len(langs)))
+				if *refineFlag {
+					refineRequests, _, _ := EstimateTranslation(planCues, videoDuration, config.ChunkTokens/2)
+					details = append(details, fmt.Sprintf("Review requests (--refine): %d per language, %d in total", refineRequests, refineRequests*len(langs)))
+				}
+				if planCues == nil {
+					details = append(details, "Rough estimate based on duration, real numbers are known after transcription")
+				}
+			} else {
+				details = append(details, "Requests: unknown, couldn't read media duration")
+			}
+			PrintPlan("Translation using "+translatorNames[*translatorFlag]+".", details...)
+		}
+
+		var outputs []string
+		if *ytdlpFlag {
+			srtSources, trackLangs := []string{srtTmp}, []Language{ParseLanguage("en")}
+			if *geminiFlag {
+				srtSources, trackLangs = translatedTmps, langs
+			}
+			var embedTmps []string
+			for i := range srtSources {
+				embedTmps = append(embedTmps, path.Join(appDir, "tmp", "embed"+strconv.Itoa(i)+"."+*formatFlag))
+			}
+			RunCommand("Embedding Subtitles.", EmbedCommand(videoTmp, embedTmps, trackLangs, sourceLang, *formatFlag, videoOutput)...)
+			outputs = []string{videoOutput}
+		} else if isSrtInput {
+			outputs = translatedOutputs
+		} else if *geminiFlag {
+			outputs = append([]string{srtOutput}, translatedOutputs...)
 		} else {
-			myspinner.Start("Translation using Google Gemini AI.")
+			outputs = []string{srtTranslatedOutput}
+		}
+		PrintPlan("Output files.", outputs...)
+		os.Exit(0)
+	}
+
+	// Load .srt or .vtt file, whisper output without translation is parsed only when converted
+	var cues []Cue
+	if *geminiFlag {
+		fileToRead := srtTmp
+		if isSrtInput {
+			fileToRead = srtInput
 		}
 
+		cues, err = ReadSubtitlesFile(fileToRead)
+		if err != nil {
+			fmt.Println("Subtitles parsing error:", fileToRead)
+			PrintError(err)
+			os.Exit(1)
+		}
+		DebugLog("Subtitles sections count:", len(cues))
+
+		// Init translator
 		ctx := context.Background()
-		client, err := genai.NewClient(ctx, option.WithAPIKey(config.Key))
+		if config.LibreTranslate.Source == "auto" && sourceLang.Code != "" {
+			config.LibreTranslate.Source = sourceLang.Code
+		}
+		translator, err := NewTranslator(ctx, *translatorFlag, config, *jsonFlag)
 		if err != nil {
-			fmt.Println("Gemini error.")
+			fmt.Println("Translator error.")
 			PrintError(err)
 			os.Exit(1)
 		}
-		defer client.Close()
+		defer translator.Close()
+
+		// Split srt into parts
+		DebugLog("Translation languages:", strings.Join(LanguageNames(langs), ", "))
 
-		model := client.GenerativeModel("gemini-2.0-flash")
+		countTokens := NewTokenEstimator(ctx, translator, FormatSRT(cues))
+		parts := SplitChunks(cues, config.ChunkTokens, countTokens)
+		DebugLog("Required API requests per language:", len(parts))
 
-		model.SafetySettings = []*genai.SafetySetting{
-			{
-				Category:  genai.HarmCategoryHarassment,
-				Threshold: genai.HarmBlockNone,
-			},
-			{
-				Category:  genai.HarmCategoryHateSpeech,
-				Threshold: genai.HarmBlockNone,
-			},
-			{
-				Category:  genai.HarmCategorySexuallyExplicit,
-				Threshold: genai.HarmBlockNone,
-			},
-			{
-				Category:  genai.HarmCategoryDangerousContent,
-				Threshold: genai.HarmBlockNone,
-			},
+		// Review prompt has both source and translation, chunk boundaries differ from first pass
+		var refineParts [][]Cue
+		if *refineFlag {
+			refineParts = SplitChunks(cues, config.ChunkTokens/2, countTokens)
+			DebugLog("Required review requests per language:", len(refineParts))
 		}
 
-		cs := model.StartChat()
-		cs.History = []*genai.Content{}
+		var cache *Cache
+		if !*noCacheFlag {
+			cache = NewCache(path.Join(appDir, "cache"))
+		}
 
-		// Split srt into parts
-		DebugLog("Translation language:", *langFlag)
-		DebugLog("Characters count:", len(transcription))
-		subtitles := ParseSRT(transcription)
-		DebugLog("Subtitles sections count:", len(subtitles))
-
-		var parts []string
-		var part string
-		for _, section := range subtitles {
-			part += section + "\n"
-
-			// tokResp, err := model.CountTokens(ctx, genai.Text(part))
-			// if err != nil {
-			// 	fmt.Println("Gemini API model token count error:", err)
-			// 	os.Exit(1)
-			// }
-			// fmt.Println("total_tokens:", tokResp.TotalTokens)
-
-			if len(part) > 8500 {
-				parts = append(parts, part)
-				part = ""
-			}
-		}
-		if len(part) > 0 {
-			parts = append(parts, part)
-		}
-		DebugLog("Required API requests:", len(parts))
-
-		// Finally make API calls
-		var translatedSubtitles string
-		for index, section := range parts {
-			DebugLog("Request #", index+1)
-			var prompt string
-			if index == 0 {
-				prompt = "Translate these SRT subtitles into " + *langFlag + ". Return them as valid SRT subtitles. Subtitles to translate:\n" + section
+		title := fileName
+		if videoMetadata != nil && videoMetadata.Title != "" {
+			title = videoMetadata.Title
+		}
+
+		// Token usage of all languages
+		usage := &Usage{}
+		logUsage := func() {
+			if usage.Requests == 0 {
+				return
+			}
+			cost, priced := usage.Cost(translator.Name(), config.Prices)
+			message := fmt.Sprintf("Token usage: %d requests, %d input tokens, %d output tokens", usage.Requests, usage.InputTokens, usage.OutputTokens)
+			if priced {
+				message += fmt.Sprintf(", estimated cost $%.4f", cost)
+			}
+			fmt.Println(message + ".")
+			if err := AppendUsageLog(*usage, translator.Name(), LanguageNames(langs), cost, priced, url); err != nil {
+				DebugLog("Couldn't save usage log:", err)
+			}
+		}
+
+		var jobPaths []string
+		for langIndex, lang := range langs {
+			// Transcription is already in target language
+			if sourceLang.Code != "" && sourceLang.Code == lang.Code {
+				fmt.Println("Subtitles are already in " + lang.Name + ", translation skipped.")
+				if err := os.WriteFile(translatedTmps[langIndex], []byte(FormatSRT(cues)), 0644); err != nil {
+					PrintError(err)
+					os.Exit(1)
+				}
+				continue
+			}
+
+			myspinner := spinner.New()
+			message := "Translation into " + lang.Name + " using " + translatorNames[*translatorFlag] + "."
+			if verboseMode {
+				fmt.Println(message)
 			} else {
-				prompt = section
+				myspinner.Start(message)
 			}
 
-			res, err := cs.SendMessage(ctx, genai.Text(prompt))
+			prompt, err := RenderPrompt(promptTemplate, PromptData{Lang: lang.Name, SourceLang: sourceLang.Name, Title: title, Genre: config.Prompt.Genre, Video: videoMetadata})
 			if err != nil {
-				DebugLog("Gemini API error.")
+				if !verboseMode {
+					myspinner.Error()
+				}
 				PrintError(err)
-				DebugLog("Retrying...")
-				DebugLog("Request #", index+1)
-				time.Sleep(90 * time.Second)
+				os.Exit(1)
+			}
+			DebugLog("Translation prompt:", prompt)
+			var warnings []string
+			translateOptions := TranslateOptions{Lang: lang.Name, JSONMode: *jsonFlag, Prompt: prompt, Glossary: glossary.ForLang(lang), ContextCues: config.ContextCues, Retry: config.Retry, Cache: cache, Usage: usage, Warnings: &warnings}
+
+			// Load progress of previous failed run
+			jobPath := JobPath(cues, *translatorFlag, translateOptions)
+			job, err := LoadJob(jobPath, jobInput, lang.Name)
+			if err != nil {
+				DebugLog("Couldn't load job file, starting from scratch:", err)
+			}
+			DebugLog("Job file:", jobPath)
+			resumed := 0
+			for _, chunk := range parts {
+				if _, ok := job.Translated(chunk); ok {
+					resumed++
+				}
+			}
+			if resumed > 0 {
+				message := fmt.Sprintf("Resuming translation into %s, %d of %d requests already done.", lang.Name, resumed, len(parts))
+				if verboseMode {
+					fmt.Println(message)
+				} else {
+					myspinner.UpdateMessage(message)
+				}
+			}
 
-				res, err = cs.SendMessage(ctx, genai.Text(prompt))
+			// Finally make API calls
+			var translatedCues []Cue
+			var failedCues []FailedCue
+			for index, chunk := range parts {
+				if translated, ok := job.Translated(chunk); ok {
+					DebugLog("Request #", index+1, "loaded from job file")
+					translatedCues = append(translatedCues, translated...)
+					continue
+				}
+
+				DebugLog("Request #", index+1, "estimated tokens:", countTokens(FormatSRT(chunk)))
+				previous := PreviousCues(cues, translatedCues, config.ContextCues)
+				requestsBefore := usage.Requests
+				translated, failed, err := TranslateChunk(ctx, translator, chunk, previous, translateOptions)
 				if err != nil {
 					if !verboseMode {
 						myspinner.Error()
 					}
-					fmt.Println("Gemini API error.")
+					fmt.Println("Translation error, language:", lang.Name, "request #", index+1)
 					PrintError(err)
+					if len(job.Translations) > 0 || langIndex > 0 || transcriptionJobPath != "" {
+						fmt.Println("TIP: Translation progress is saved, run the same command again to resume.")
+					}
+					logUsage()
 					os.Exit(1)
 				}
+				translatedCues = append(translatedCues, translated...)
+				failedCues = append(failedCues, failed...)
+
+				job.Add(translated, failed)
+				if err := job.Save(jobPath); err != nil {
+					DebugLog("Couldn't save job file:", err)
+				}
+
+				// Pause for Gemini rate limits, chunks loaded from cache and local servers don't need it
+				if *translatorFlag == "gemini" && usage.Requests > requestsBefore && index != 0 {
+					time.Sleep(5 * time.Second)
+				}
+			}
+			if verboseMode {
+				fmt.Println("Translation done.")
+			} else {
+				myspinner.Success()
 			}
-			translatedSubtitles += PrintResponse(res)
 
-			if index != 0 {
-				time.Sleep(5 * time.Second)
+			if len(warnings) > 0 {
+				fmt.Printf("Repaired translation (%s), check these subtitles:\n", lang.Name)
+				for _, warning := range warnings {
+					fmt.Println("  " + warning)
+				}
 			}
-		}
-		if verboseMode {
-			fmt.Println("Translation done.")
-		} else {
-			myspinner.Success()
+			if len(failedCues) > 0 {
+				fmt.Printf("Untranslated subtitles (%s), source text kept:\n", lang.Name)
+				for _, cue := range failedCues {
+					fmt.Printf("  cue %d: %s\n", cue.Index, cue.Reason)
+				}
+			}
+
+			// Second pass, only changed cues are returned by reviewer
+			if *refineFlag {
+				myspinner := spinner.New()
+				message := "Reviewing translation into " + lang.Name + "."
+				if verboseMode {
+					fmt.Println(message)
+				} else {
+					myspinner.Start(message)
+				}
+
+				var refinedCues []Cue
+				var edits []CueEdit
+				offset := 0
+				for index, chunk := range refineParts {
+					previous := PreviousCues(cues, refinedCues, config.ContextCues)
+					refined, chunkEdits, err := RefineChunk(ctx, translator.(ChatTranslator), chunk, translatedCues[offset:offset+len(chunk)], previous, translateOptions)
+					if err != nil {
+						if !verboseMode {
+							myspinner.Error()
+						}
+						fmt.Println("Review error, language:", lang.Name, "request #", index+1)
+						PrintError(err)
+						logUsage()
+						os.Exit(1)
+					}
+					offset += len(chunk)
+					refinedCues = append(refinedCues, refined...)
+					edits = append(edits, chunkEdits...)
+				}
+				translatedCues = refinedCues
+
+				reportPath := path.Join(outputDir, LangFileName(fileName, langs, lang)+".refine.txt")
+				if err := WriteRefineReport(reportPath, cues, edits); err != nil {
+					PrintError(err)
+				}
+				message = fmt.Sprintf("Review done, %d subtitles changed: %s", len(edits), reportPath)
+				if verboseMode {
+					fmt.Println(message)
+				} else {
+					myspinner.Success(message)
+				}
+			}
+
+			if warnings := CheckGlossary(cues, translatedCues, translateOptions.Glossary); len(warnings) > 0 {
+				fmt.Printf("Glossary warnings (%s):\n", lang.Name)
+				for _, warning := range warnings {
+					fmt.Println("  " + warning)
+				}
+			}
+
+			// Quality checks, report is removed when previous run left one
+			qaReportPath := path.Join(outputDir, LangFileName(fileName, langs, lang)+".qa.txt")
+			if issues := CheckTranslation(cues, translatedCues); len(issues) > 0 {
+				var numbers []string
+				for _, issue := range issues {
+					numbers = append(numbers, strconv.Itoa(issue.Index))
+				}
+				fmt.Printf("Quality check (%s): %d suspicious subtitles: %s\n", lang.Name, len(issues), strings.Join(numbers, ", "))
+				if err := WriteQAReport(qaReportPath, cues, translatedCues, issues); err != nil {
+					PrintError(err)
+				} else {
+					fmt.Println("Report:", qaReportPath)
+				}
+				if *strictFlag {
+					exitCode = 1
+				}
+			} else if FileExists(qaReportPath) {
+				os.Remove(qaReportPath)
+			}
+
+			// Save translation to file
+			if err := os.WriteFile(translatedTmps[langIndex], []byte(FormatSRT(translatedCues)), 0644); err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+			DebugLog("Created file: ", translatedTmps[langIndex])
+			jobPaths = append(jobPaths, jobPath)
 		}
 
-		// Save translation to file
-		if err := os.WriteFile(srtTranslatedTmp, []byte(translatedSubtitles), 0644); err != nil {
-			PrintError(err)
-			os.Exit(1)
+		logUsage()
+
+		// Job files are kept until all languages are translated
+		for _, jobPath := range jobPaths {
+			DebugLog("Deleting file:", jobPath)
+			os.Remove(jobPath)
+		}
+		if transcriptionJobPath != "" {
+			DebugLog("Deleting file:", transcriptionJobPath)
+			os.Remove(transcriptionJobPath)
 		}
-		DebugLog("Created file: ", srtTranslatedTmp)
 	}
 
 	// Move files from temp folder
-	if *ytdlpFlag {
-		outputDir = currentDir
-	} else if isSrtInput {
-		outputDir = path.Dir(srtInput)
-	} else {
-		outputDir = path.Dir(videoInput)
-	}
-
-	srtOutput = path.Join(outputDir, fileName+" (transcription).srt")
-	srtTranslatedOutput = path.Join(outputDir, fileName+".srt")
-	videoOutput = path.Join(outputDir, fileName+".mkv")
-
 	if isSrtInput == true {
-		if MoveFile(srtTranslatedTmp, srtTranslatedOutput); err != nil {
-			PrintError(err)
+		for i := range langs {
+			if err := ExportSubtitles(translatedTmps[i], translatedOutputs[i], *formatFlag, cues, *bilingualFlag); err != nil {
+				PrintError(err)
+			}
 		}
 
 		fmt.Println("\nSubtitles ready!")
-		fmt.Println(srtTranslatedOutput)
-		os.Exit(0)
+		fmt.Println(strings.Join(translatedOutputs, "\n"))
+		os.Exit(exitCode)
 	}
 
 	if *ytdlpFlag {
-		var srtSource, lang string
+		var srtSources []string
+		var trackLangs []Language
 		if *geminiFlag {
-			srtSource = srtTranslatedTmp
-			lang = *langFlag
+			srtSources = translatedTmps
+			trackLangs = langs
 		} else {
-			srtSource = srtTmp
-			lang = "eng"
+			srtSources = []string{srtTmp}
+			trackLangs = []Language{ParseLanguage("en")}
+		}
+
+		// Every subtitles file is embedded as separate track
+		var embedTmps []string
+		for i, srtSource := range srtSources {
+			embedTmp := path.Join(appDir, "tmp", "embed"+strconv.Itoa(i)+"."+*formatFlag)
+			if err := ExportSubtitles(srtSource, embedTmp, *formatFlag, cues, *bilingualFlag); err != nil {
+				PrintError(err)
+				os.Exit(1)
+			}
+			embedTmps = append(embedTmps, embedTmp)
 		}
 
-		RunCommand("Embedding Subtitles.", "ffmpeg", "-y", "-i", videoTmp, "-i", srtSource, "-c", "copy", "-c:s", "srt", "-metadata:s:s:0", "language="+lang, videoOutput)
+		RunCommand("Embedding Subtitles.", EmbedCommand(videoTmp, embedTmps, trackLangs, sourceLang, *formatFlag, videoOutput)...)
 
+		for _, embedTmp := range embedTmps {
+			DebugLog("Deleting file:", embedTmp)
+			os.Remove(embedTmp)
+		}
 		DebugLog("Deleting file:", videoTmp)
 		os.Remove(videoTmp)
 		DebugLog("Deleting file:", srtTmp)
 		os.Remove(srtTmp)
 		if *geminiFlag {
-			DebugLog("Deleting file:", srtTranslatedTmp)
-			os.Remove(srtTranslatedTmp)
+			for _, translatedTmp := range translatedTmps {
+				DebugLog("Deleting file:", translatedTmp)
+				os.Remove(translatedTmp)
+			}
 		}
 
 		fmt.Println("\nSubtitles ready!")
 		fmt.Println(videoOutput)
-		os.Exit(0)
+		os.Exit(exitCode)
 	}
 
 	if *geminiFlag {
-		if MoveFile(srtTmp, srtOutput); err != nil {
+		if err := ExportSubtitles(srtTmp, srtOutput, *formatFlag, nil, false); err != nil {
 			PrintError(err)
 		}
 
-		if MoveFile(srtTranslatedTmp, srtTranslatedOutput); err != nil {
-			PrintError(err)
+		for i := range langs {
+			if err := ExportSubtitles(translatedTmps[i], translatedOutputs[i], *formatFlag, cues, *bilingualFlag); err != nil {
+				PrintError(err)
+			}
 		}
 
 	} else {
-		if MoveFile(srtTmp, srtTranslatedOutput); err != nil {
+		if err := ExportSubtitles(srtTmp, srtTranslatedOutput, *formatFlag, nil, false); err != nil {
 			PrintError(err)
 		}
 	}
 
 	fmt.Println("\nSubtitles ready!")
+	os.Exit(exitCode)
 }
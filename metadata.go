@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Video info used as translation context
+type VideoMetadata struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Uploader    string   `json:"uploader"`
+	Tags        []string `json:"tags"`
+	// Seconds
+	Duration float64 `json:"duration"`
+}
+
+// Longer descriptions are cut to keep prompts small
+const maxDescriptionLength = 1000
+
+// Returns metadata and file name of video downloaded later with the same name template
+func FetchYtdlpMetadata(url string, nameTemplate string) (*VideoMetadata, string, error) {
+	cmd := exec.Command("yt-dlp", "--windows-filenames", "--remux-video", "mkv", "-o", nameTemplate, "--dump-json", url)
+
+	// Tmp fix for Windows cmd output not in utf-8
+	if runtime.GOOS == "windows" {
+		cmd.Args = append(cmd.Args, "--restrict-filenames")
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, "", errors.New(strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, "", err
+	}
+
+	var info struct {
+		VideoMetadata
+		Filename string `json:"_filename"`
+	}
+	// Playlists print one JSON per line, only first video is used
+	if err := json.NewDecoder(bytes.NewReader(output)).Decode(&info); err != nil {
+		return nil, "", err
+	}
+	if info.Filename == "" {
+		return nil, "", errors.New("yt-dlp didn't return file name")
+	}
+
+	metadata := info.VideoMetadata
+	metadata.Description = truncateDescription(metadata.Description)
+	return &metadata, info.Filename, nil
+}
+
+// Reads container tags of local file using ffprobe, returns nil when file has no useful tags
+func ProbeMetadata(filePath string) (*VideoMetadata, error) {
+	cmd := exec.Command("ffprobe", "-v", "quiet", "-print_format", "json", "-show_format", filePath)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var probe struct {
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal(output, &probe); err != nil {
+		return nil, err
+	}
+
+	// Tag names differ in case between containers, e.g. TITLE in mkv
+	tags := make(map[string]string)
+	for key, value := range probe.Format.Tags {
+		tags[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+
+	metadata := &VideoMetadata{
+		Title:       tags["title"],
+		Description: tags["description"],
+		Uploader:    tags["artist"],
+	}
+	if metadata.Description == "" {
+		metadata.Description = tags["comment"]
+	}
+	metadata.Description = truncateDescription(metadata.Description)
+	if genre := tags["genre"]; genre != "" {
+		metadata.Tags = []string{genre}
+	}
+
+	if metadata.Title == "" && metadata.Description == "" {
+		return nil, nil
+	}
+	return metadata, nil
+}
+
+func truncateDescription(description string) string {
+	description = strings.TrimSpace(description)
+	runes := []rune(description)
+	if len(runes) > maxDescriptionLength {
+		return string(runes[:maxDescriptionLength]) + "…"
+	}
+	return description
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Translation backend for local Ollama server
+type OllamaTranslator struct {
+	config   OllamaConfig
+	jsonMode bool
+}
+
+type ollamaRequest struct {
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Format   any            `json:"format,omitempty"`
+	Options  map[string]any `json:"options,omitempty"`
+}
+
+type ollamaResponse struct {
+	Message    chatMessage `json:"message"`
+	DoneReason string      `json:"done_reason"`
+	// Token counts
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+// JSON schema of response in JSON mode, same as Gemini response schema
+var ollamaCuesSchema = map[string]any{
+	"type": "array",
+	"items": map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":   map[string]any{"type": "integer"},
+			"text": map[string]any{"type": "string"},
+		},
+		"required": []string{"id", "text"},
+	},
+}
+
+func NewOllamaTranslator(config OllamaConfig, jsonMode bool) *OllamaTranslator {
+	return &OllamaTranslator{config: config, jsonMode: jsonMode}
+}
+
+func (t *OllamaTranslator) Complete(ctx context.Context, system string, prompt string) (string, Usage, error) {
+	messages := []chatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}
+	request := ollamaRequest{Model: t.config.Model, Messages: messages}
+	if t.jsonMode {
+		request.Format = ollamaCuesSchema
+	}
+	if t.config.Context > 0 {
+		request.Options = map[string]any{"num_ctx": t.config.Context}
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	url := strings.TrimSuffix(t.config.Host, "/") + "/api/chat"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", Usage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", Usage{}, NewHTTPError(resp, respBody)
+	}
+
+	var res ollamaResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return "", Usage{}, err
+	}
+	usage := Usage{InputTokens: res.PromptEvalCount, OutputTokens: res.EvalCount}
+	if res.DoneReason == "length" {
+		return "", usage, &IncompleteResponseError{Reason: res.DoneReason}
+	}
+	if res.DoneReason != "" && res.DoneReason != "stop" {
+		fmt.Println(redANSI + "Finish reason other than [stop]" + resetANSI)
+		fmt.Println("Finish reason:", res.DoneReason)
+	}
+
+	return TrimCodeFence(res.Message.Content), usage, nil
+}
+
+func (t *OllamaTranslator) Name() string {
+	return "ollama/" + t.config.Model
+}
+
+func (t *OllamaTranslator) Close() error {
+	return nil
+}
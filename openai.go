@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Translation backend for any OpenAI-compatible /v1/chat/completions endpoint
+type OpenAITranslator struct {
+	config OpenAIConfig
+}
+
+type openAIRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+}
+
+type openAIResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func NewOpenAITranslator(config OpenAIConfig) *OpenAITranslator {
+	return &OpenAITranslator{config: config}
+}
+
+func (t *OpenAITranslator) Complete(ctx context.Context, system string, prompt string) (string, Usage, error) {
+	messages := []chatMessage{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}
+	body, err := json.Marshal(openAIRequest{Model: t.config.Model, Messages: messages})
+	if err != nil {
+		return "", Usage{}, err
+	}
+
+	url := strings.TrimSuffix(t.config.Url, "/") + "/chat/completions"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", Usage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if t.config.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+t.config.Key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", Usage{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", Usage{}, NewHTTPError(resp, respBody)
+	}
+
+	var res openAIResponse
+	if err := json.Unmarshal(respBody, &res); err != nil {
+		return "", Usage{}, err
+	}
+	if len(res.Choices) == 0 {
+		return "", Usage{}, errors.New("empty response from OpenAI-compatible API")
+	}
+
+	usage := Usage{InputTokens: res.Usage.PromptTokens, OutputTokens: res.Usage.CompletionTokens}
+	choice := res.Choices[0]
+	switch choice.FinishReason {
+	case "stop":
+	case "length", "content_filter":
+		return "", usage, &IncompleteResponseError{Reason: choice.FinishReason}
+	default:
+		fmt.Println(redANSI + "Finish reason other than [stop]" + resetANSI)
+		fmt.Println("Finish reason:", choice.FinishReason)
+	}
+
+	return TrimCodeFence(choice.Message.Content), usage, nil
+}
+
+func (t *OpenAITranslator) Name() string {
+	return "openai/" + t.config.Url + "/" + t.config.Model
+}
+
+func (t *OpenAITranslator) Close() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rough size of SRT transcription per minute of speech, used by --dry-run before transcription exists
+const estimatedTokensPerMinute = 400
+
+// Prints step of --dry-run
+func PrintPlan(message string, details ...string) {
+	fmt.Println(invertANSI, "━━━", message, "━━━", resetANSI)
+	for _, detail := range details {
+		fmt.Println("  " + detail)
+	}
+	fmt.Println("")
+}
+
+// Returns command as it could be pasted into shell
+func FormatCommand(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'$&|;<>()*?[]#~`\\") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		} else {
+			quoted[i] = arg
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// faster-whisper stores models downloaded from Hugging Face as models--<owner>--<name> directories
+func FasterWhisperModelExists(modelsDir string, model string) bool {
+	pattern := "models--*--faster-whisper-" + model
+	if strings.Contains(model, "/") {
+		pattern = "models--" + strings.ReplaceAll(model, "/", "--")
+	}
+	matches, _ := filepath.Glob(path.Join(modelsDir, pattern))
+	return len(matches) > 0
+}
+
+// Returns media duration using ffprobe
+func ProbeDuration(filePath string) (time.Duration, error) {
+	output, err := exec.Command("ffprobe", "-v", "quiet", "-show_entries", "format=duration", "-of", "default=noprint_wrappers=1:nokey=1", filePath).Output()
+	if err != nil {
+		return 0, err
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// Returns number of requests and tokens per language, calculated from subtitles
+// when they exist or roughly estimated from media duration otherwise
+func EstimateTranslation(cues []Cue, duration time.Duration, chunkTokens int) (int, int, bool) {
+	if cues != nil {
+		tokens := 0
+		for _, cue := range cues {
+			tokens += EstimateTokens(FormatSRT([]Cue{cue}))
+		}
+		return len(SplitChunks(cues, chunkTokens, EstimateTokens)), tokens, true
+	}
+
+	if duration <= 0 {
+		return 0, 0, false
+	}
+	tokens := int(duration.Minutes() * estimatedTokensPerMinute)
+	return int(math.Ceil(float64(tokens) / float64(chunkTokens))), tokens, true
+}
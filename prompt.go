@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// [prompt] section of config file
+type PromptConfig struct {
+	// Go template of translation instruction, output format instructions are added automatically
+	Template string
+	// File with template, used instead of Template when set
+	File     string
+	Genre    string
+	Glossary string
+	// Fetch title and description of video with yt-dlp or ffprobe
+	Metadata bool
+}
+
+const defaultPromptTemplate = `You are a professional subtitles translator. Translate the subtitles you receive into {{.Lang}}.{{if .Genre}} The video genre is {{.Genre}}.{{end}}
+{{with .Video}}
+Information about the video, use it only as context for names and topic:
+Title: {{.Title}}
+{{if .Uploader}}Uploader: {{.Uploader}}
+{{end}}{{if .Tags}}Tags: {{join .Tags ", "}}
+{{end}}{{if .Description}}Description: {{.Description}}
+{{end}}{{end}}`
+
+// Variables available in prompt template
+type PromptData struct {
+	Lang string
+	// Language set with --source-lang or detected by whisper, empty when unknown
+	SourceLang string
+	// Video title or file name when metadata is not available
+	Title string
+	Genre string
+	// Nil when metadata is disabled or not available
+	Video *VideoMetadata
+}
+
+// Returns prompt template from config, file takes precedence over template text
+func LoadPromptTemplate(config PromptConfig) (*template.Template, error) {
+	text := config.Template
+	if config.File != "" {
+		buff, err := os.ReadFile(config.File)
+		if err != nil {
+			return nil, err
+		}
+		text = string(buff)
+	}
+	if strings.TrimSpace(text) == "" {
+		text = defaultPromptTemplate
+	}
+
+	tmpl, err := template.New("prompt").Funcs(template.FuncMap{"join": strings.Join}).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt template: %v", err)
+	}
+	return tmpl, nil
+}
+
+func RenderPrompt(tmpl *template.Template, data PromptData) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("invalid prompt template: %v", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// Fixed translation of name or term, Lang is empty when term applies to all languages
+type GlossaryTerm struct {
+	Source string
+	Target string
+	Lang   string
+}
+
+type Glossary []GlossaryTerm
+
+// Parses glossary file with one "source = target" term per line.
+// Terms below "[language]" header (name or code) apply only to that language, "#" starts a comment.
+func LoadGlossary(glossaryPath string) (Glossary, error) {
+	file, err := os.Open(glossaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var glossary Glossary
+	var lang string
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			lang = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+
+		source, target, ok := strings.Cut(line, "=")
+		source, target = strings.TrimSpace(source), strings.TrimSpace(target)
+		if !ok || source == "" || target == "" {
+			return nil, fmt.Errorf("glossary line %d: expected \"source = target\"", number)
+		}
+		glossary = append(glossary, GlossaryTerm{Source: source, Target: target, Lang: lang})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(glossary) == 0 {
+		return nil, errors.New("glossary file has no terms")
+	}
+	return glossary, nil
+}
+
+// Returns terms for given language, language specific terms override general ones
+func (g Glossary) ForLang(lang Language) Glossary {
+	var terms Glossary
+	index := make(map[string]int)
+	for _, term := range g {
+		if term.Lang != "" && !lang.Matches(term.Lang) {
+			continue
+		}
+
+		key := strings.ToLower(term.Source)
+		if i, ok := index[key]; ok {
+			if term.Lang != "" {
+				terms[i] = term
+			}
+			continue
+		}
+		index[key] = len(terms)
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// Glossary section of system instruction
+func (g Glossary) Instruction() string {
+	if len(g) == 0 {
+		return ""
+	}
+
+	text := "Always use these translations of names and terms:\n"
+	for _, term := range g {
+		text += term.Source + " => " + term.Target + "\n"
+	}
+	return text
+}
+
+// Returns warnings for cues where source contains glossary term but translation doesn't contain its translation
+func CheckGlossary(source []Cue, translated []Cue, glossary Glossary) []string {
+	var warnings []string
+	for i := 0; i < len(source) && i < len(translated); i++ {
+		sourceText := strings.ToLower(source[i].Text())
+		translatedText := strings.ToLower(translated[i].Text())
+		for _, term := range glossary {
+			if strings.Contains(sourceText, strings.ToLower(term.Source)) && !strings.Contains(translatedText, strings.ToLower(term.Target)) {
+				warnings = append(warnings, fmt.Sprintf("cue %d: %q is not translated as %q", source[i].Index, term.Source, term.Target))
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Suspicious translated cue found by quality checks
+type QAIssue struct {
+	Index   int
+	Problem string
+}
+
+// Scripts detected by quality checks, Japanese kana are counted as Han so Japanese text has one script
+var qaScripts = []struct {
+	name   string
+	tables []*unicode.RangeTable
+}{
+	{"Latin", []*unicode.RangeTable{unicode.Latin}},
+	{"Cyrillic", []*unicode.RangeTable{unicode.Cyrillic}},
+	{"Greek", []*unicode.RangeTable{unicode.Greek}},
+	{"Arabic", []*unicode.RangeTable{unicode.Arabic}},
+	{"Hebrew", []*unicode.RangeTable{unicode.Hebrew}},
+	{"Han", []*unicode.RangeTable{unicode.Han, unicode.Hiragana, unicode.Katakana}},
+	{"Hangul", []*unicode.RangeTable{unicode.Hangul}},
+	{"Thai", []*unicode.RangeTable{unicode.Thai}},
+	{"Devanagari", []*unicode.RangeTable{unicode.Devanagari}},
+}
+
+// Length ratio of cue this many times below or above median ratio is suspicious
+const qaLengthFactor = 3.0
+
+// Shorter cues are skipped by length check, e.g. "Yes." can be translated with one character
+const qaMinLength = 10
+
+// Returns script with most letters in text, empty if text has no letters
+func dominantScript(text string) string {
+	counts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		for _, script := range qaScripts {
+			if unicode.In(r, script.tables...) {
+				counts[script.name]++
+				break
+			}
+		}
+	}
+
+	var best string
+	for _, script := range qaScripts {
+		if counts[script.name] > counts[best] {
+			best = script.name
+		}
+	}
+	return best
+}
+
+func letterCount(text string) int {
+	count := 0
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// Detects empty and untranslated cues, cues in source script, abnormal length and repeated lines.
+// Translated cues must be aligned with source cues.
+func CheckTranslation(source []Cue, translated []Cue) []QAIssue {
+	var sourceText, translatedText strings.Builder
+	for i := 0; i < len(source) && i < len(translated); i++ {
+		sourceText.WriteString(source[i].Text() + "\n")
+		translatedText.WriteString(translated[i].Text() + "\n")
+	}
+
+	// Check is disabled when target language uses the same script
+	sourceScript := dominantScript(sourceText.String())
+	checkScript := sourceScript != "" && sourceScript != dominantScript(translatedText.String())
+
+	// Median ratio is used as reference, because length differs a lot between languages
+	var ratios []float64
+	for i := 0; i < len(source) && i < len(translated); i++ {
+		if sourceLength := letterCount(source[i].Text()); sourceLength >= qaMinLength {
+			ratios = append(ratios, float64(letterCount(translated[i].Text()))/float64(sourceLength))
+		}
+	}
+	var median float64
+	if len(ratios) > 0 {
+		sort.Float64s(ratios)
+		median = ratios[len(ratios)/2]
+	}
+
+	var issues []QAIssue
+	for i := 0; i < len(source) && i < len(translated); i++ {
+		src := strings.TrimSpace(source[i].Text())
+		text := strings.TrimSpace(translated[i].Text())
+		add := func(problem string) {
+			issues = append(issues, QAIssue{Index: source[i].Index, Problem: problem})
+		}
+
+		if letterCount(src) == 0 {
+			continue
+		}
+		if text == "" {
+			add("empty translation")
+			continue
+		}
+		if strings.EqualFold(src, text) && letterCount(src) > 3 {
+			add("not translated")
+			continue
+		}
+		if checkScript && dominantScript(text) == sourceScript {
+			add("still in source script (" + sourceScript + ")")
+			continue
+		}
+
+		if sourceLength := letterCount(src); sourceLength >= qaMinLength && median > 0 {
+			ratio := float64(letterCount(text)) / float64(sourceLength)
+			if ratio < median/qaLengthFactor {
+				add(fmt.Sprintf("translation too short (%d of %d characters)", letterCount(text), sourceLength))
+				continue
+			}
+			if ratio > median*qaLengthFactor {
+				add(fmt.Sprintf("translation too long (%d of %d characters)", letterCount(text), sourceLength))
+				continue
+			}
+		}
+
+		// Model stuck on one line repeats it for different source lines
+		if i > 0 && strings.EqualFold(text, strings.TrimSpace(translated[i-1].Text())) && !strings.EqualFold(src, strings.TrimSpace(source[i-1].Text())) {
+			add("repeated line of previous subtitle")
+		}
+	}
+	return issues
+}
+
+// Writes list of suspicious cues with source and translated text
+func WriteQAReport(reportPath string, source []Cue, translated []Cue, issues []QAIssue) error {
+	cues := make(map[int][2]string)
+	for i := 0; i < len(source) && i < len(translated); i++ {
+		cues[source[i].Index] = [2]string{strings.Join(source[i].Lines, " / "), strings.Join(translated[i].Lines, " / ")}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d suspicious subtitles\n", len(issues))
+	for _, issue := range issues {
+		fmt.Fprintf(&sb, "\n#%d %s\n", issue.Index, issue.Problem)
+		fmt.Fprintf(&sb, "  %s\n", cues[issue.Index][0])
+		fmt.Fprintf(&sb, "  %s\n", cues[issue.Index][1])
+	}
+	return os.WriteFile(reportPath, []byte(sb.String()), 0644)
+}
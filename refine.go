@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Cue changed by --refine pass
+type CueEdit struct {
+	Cue    Cue
+	Before []string
+}
+
+// Cue sent to reviewer with source and first pass translation
+type refineCue struct {
+	ID          int    `json:"id"`
+	Source      string `json:"source"`
+	Translation string `json:"translation"`
+}
+
+// Reviews translation of chunk and returns it with edits applied. Reviewer returns only changed cues,
+// so invalid or incomplete review keeps first pass translation instead of failing whole run.
+func RefineChunk(ctx context.Context, translator ChatTranslator, source []Cue, translated []Cue, previous []Cue, opts TranslateOptions) ([]Cue, []CueEdit, error) {
+	system := "You are a professional subtitles proofreader. You receive subtitles with their translation into " + opts.Lang + ". " +
+		"Fix mistranslations, inconsistent pronouns, names and terms, and awkward phrasing, keep the meaning and similar length. " +
+		"Return only the subtitles you changed as a JSON array of objects with \"id\" and corrected \"text\", keep line breaks. Return [] when nothing needs to be changed."
+	if glossary := opts.Glossary.Instruction(); glossary != "" {
+		system += "\n" + glossary
+	}
+
+	items := make([]refineCue, len(source))
+	for i, cue := range source {
+		items[i] = refineCue{ID: cue.Index, Source: cue.Text(), Translation: translated[i].Text()}
+	}
+	buff, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var contextText string
+	if len(previous) > 0 {
+		contextText = "Previous subtitles and their reviewed translations, for context only, do not return them:\n"
+		for _, cue := range previous {
+			contextText += strings.Join(cue.Original, " ") + " => " + strings.Join(cue.Lines, " ") + "\n"
+		}
+		contextText += "\n"
+	}
+	prompt := contextText + "Subtitles to review:\n" + string(buff)
+
+	key := CacheKey(translator.Name(), "refine", system, prompt)
+	if res, ok := opts.Cache.Get(key); ok {
+		if edits, err := parseRefineResponse(translated, res); err == nil {
+			DebugLog("Review loaded from cache")
+			return applyEdits(translated, edits)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		var res string
+		err := opts.Retry.Do(ctx, func() error {
+			var usage Usage
+			var err error
+			res, usage, err = translator.Complete(ctx, system, prompt)
+			usage.Requests = 1
+			opts.Usage.Add(usage)
+			DebugLog("Request tokens, input:", usage.InputTokens, "output:", usage.OutputTokens)
+			return err
+		})
+		var incomplete *IncompleteResponseError
+		if errors.As(err, &incomplete) {
+			DebugLog("Review skipped:", err)
+			return translated, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		edits, err := parseRefineResponse(translated, res)
+		if err == nil {
+			if err := opts.Cache.Put(key, res); err != nil {
+				DebugLog("Couldn't save review in cache:", err)
+			}
+			return applyEdits(translated, edits)
+		}
+
+		if attempt == maxRepairAttempts {
+			DebugLog("Review skipped, invalid response:", err)
+			return translated, nil, nil
+		}
+		DebugLog("Invalid review:", err)
+		DebugLog("Requesting again...")
+		prompt = contextText + "Your previous answer was invalid: " + err.Error() + ". Return JSON array of changed subtitles with their original ids. Subtitles to review:\n" + string(buff)
+	}
+}
+
+// Returns corrected text by cue index, ids outside of chunk are invalid
+func parseRefineResponse(translated []Cue, res string) (map[int]string, error) {
+	var items []jsonCue
+	if err := json.Unmarshal([]byte(res), &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %v", err)
+	}
+
+	ids := make(map[int]bool)
+	for _, cue := range translated {
+		ids[cue.Index] = true
+	}
+
+	edits := make(map[int]string)
+	for _, item := range items {
+		if !ids[item.ID] {
+			return nil, fmt.Errorf("unknown id %d", item.ID)
+		}
+		edits[item.ID] = item.Text
+	}
+	return edits, nil
+}
+
+func applyEdits(translated []Cue, edits map[int]string) ([]Cue, []CueEdit, error) {
+	refined := make([]Cue, len(translated))
+	var changes []CueEdit
+	for i, cue := range translated {
+		refined[i] = cue
+		text, ok := edits[cue.Index]
+		if !ok {
+			continue
+		}
+
+		lines := splitCueText(text)
+		if len(lines) == 0 || strings.Join(lines, "\n") == cue.Text() {
+			continue
+		}
+		refined[i].Lines = lines
+		changes = append(changes, CueEdit{Cue: refined[i], Before: cue.Lines})
+	}
+	return refined, changes, nil
+}
+
+// Writes list of changed cues with source text, first pass and refined translation
+func WriteRefineReport(reportPath string, source []Cue, edits []CueEdit) error {
+	sourceText := make(map[int]string)
+	for _, cue := range source {
+		sourceText[cue.Index] = strings.Join(cue.Lines, " / ")
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d subtitles changed by --refine\n", len(edits))
+	for _, edit := range edits {
+		fmt.Fprintf(&sb, "\n#%d %s --> %s\n", edit.Cue.Index, FormatTimestamp(edit.Cue.Start, ','), FormatTimestamp(edit.Cue.End, ','))
+		fmt.Fprintf(&sb, "  %s\n", sourceText[edit.Cue.Index])
+		fmt.Fprintf(&sb, "- %s\n", strings.Join(edit.Before, " / "))
+		fmt.Fprintf(&sb, "+ %s\n", strings.Join(edit.Cue.Lines, " / "))
+	}
+	return os.WriteFile(reportPath, []byte(sb.String()), 0644)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error returned by translation API
+type APIError struct {
+	StatusCode int
+	Message    string
+	// Delay requested by server, 0 if not provided
+	RetryAfter time.Duration
+	// Daily quota exceeded, retrying won't help until quota reset
+	QuotaExhausted bool
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// Response cut off or blocked by model (max tokens, safety filters, recitation),
+// the same request would fail again so it is not retried
+type IncompleteResponseError struct {
+	Reason string
+}
+
+func (e *IncompleteResponseError) Error() string {
+	return "incomplete response, finish reason: " + e.Reason
+}
+
+func NewHTTPError(resp *http.Response, body []byte) *APIError {
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    fmt.Sprintf("HTTP Error: %d %s", resp.StatusCode, strings.TrimSpace(string(body))),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// [retry] section of config file, delays in seconds
+type RetryPolicy struct {
+	MaxAttempts int     `toml:"max_attempts"`
+	BaseDelay   float64 `toml:"base_delay"`
+	MaxDelay    float64 `toml:"max_delay"`
+}
+
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   5,
+	MaxDelay:    120,
+}
+
+// Calls fn until it succeeds, returns immediately on permanent error
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		retry, delay := classifyError(err)
+		if !retry {
+			return err
+		}
+		if attempt >= p.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+		if delay == 0 {
+			delay = p.backoff(attempt)
+		}
+
+		DebugLog("Translation API error:", err)
+		DebugLog("Retrying in", delay.Round(time.Second), "attempt", attempt+1, "of", p.MaxAttempts)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// Exponential backoff with jitter, returns delay between half and full backoff
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	seconds := p.BaseDelay
+	for i := 1; i < attempt && seconds < p.MaxDelay; i++ {
+		seconds *= 2
+	}
+	if seconds > p.MaxDelay {
+		seconds = p.MaxDelay
+	}
+
+	delay := time.Duration(seconds * float64(time.Second))
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Returns whether error is temporary and delay requested by server
+func classifyError(err error) (bool, time.Duration) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var incomplete *IncompleteResponseError
+	if errors.As(err, &incomplete) {
+		return false, 0
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		// Network errors
+		return true, 0
+	}
+
+	switch {
+	case apiErr.StatusCode == http.StatusTooManyRequests:
+		return !apiErr.QuotaExhausted, apiErr.RetryAfter
+	case apiErr.StatusCode == http.StatusRequestTimeout:
+		return true, apiErr.RetryAfter
+	case apiErr.StatusCode >= 500:
+		return true, apiErr.RetryAfter
+	}
+	// Bad key, invalid argument, etc.
+	return false, 0
+}
+
+// Parses Retry-After header in seconds or HTTP date format
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
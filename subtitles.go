@@ -0,0 +1,411 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported output formats and ffmpeg codecs used to embed them in mkv
+var subtitleCodecs = map[string]string{
+	"srt": "srt",
+	"vtt": "webvtt",
+	"ass": "ass",
+}
+
+// [bilingual] section of config file
+type BilingualStyle struct {
+	Styled bool
+	Color  string
+	Scale  int
+}
+
+var defaultBilingualStyle = BilingualStyle{
+	Styled: true,
+	Color:  "#FFFF00",
+	Scale:  80,
+}
+
+// Style of original lines in bilingual subtitles, overwritten by config file
+var bilingualStyle = defaultBilingualStyle
+
+// Single subtitle entry
+type Cue struct {
+	Index int
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+	// WebVTT cue settings, e.g. "align:start position:10%"
+	Settings string
+	// Source lines shown above Lines in bilingual subtitles
+	Original []string
+}
+
+func (c Cue) Text() string {
+	return strings.Join(c.Lines, "\n")
+}
+
+// Strict SRT parser, returns error with line number on first malformed cue
+func ParseSRT(text string) ([]Cue, error) {
+	lines := splitLines(text)
+	var cues []Cue
+
+	for i := 0; i < len(lines); {
+		// Skip blank lines between cues
+		if strings.TrimSpace(lines[i]) == "" {
+			i++
+			continue
+		}
+
+		index, err := strconv.Atoi(strings.TrimSpace(lines[i]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid cue index %q", i+1, lines[i])
+		}
+		i++
+
+		if i >= len(lines) || strings.TrimSpace(lines[i]) == "" {
+			return nil, fmt.Errorf("line %d: missing timing line for cue %d", i+1, index)
+		}
+		start, end, err := parseTiming(lines[i], ',')
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		i++
+
+		cue := Cue{Index: index, Start: start, End: end}
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			cue.Lines = append(cue.Lines, strings.TrimSpace(lines[i]))
+			i++
+		}
+		cues = append(cues, cue)
+	}
+
+	return cues, nil
+}
+
+// Strict WebVTT parser, NOTE, STYLE and REGION blocks are skipped
+func ParseVTT(text string) ([]Cue, error) {
+	lines := splitLines(text)
+	if len(lines) == 0 || !isVTTHeader(lines[0]) {
+		return nil, fmt.Errorf("line 1: missing WEBVTT header")
+	}
+
+	// Skip header block
+	i := 1
+	for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+		i++
+	}
+
+	var cues []Cue
+	for i < len(lines) {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			i++
+			continue
+		}
+
+		if isVTTBlock(line, "NOTE") || isVTTBlock(line, "STYLE") || isVTTBlock(line, "REGION") {
+			for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+				i++
+			}
+			continue
+		}
+
+		// Optional cue identifier is skipped, identifiers don't have to be numbers or unique,
+		// so cues are numbered by position
+		index := len(cues) + 1
+		if !strings.Contains(line, "-->") {
+			i++
+			if i >= len(lines) || strings.TrimSpace(lines[i]) == "" {
+				return nil, fmt.Errorf("line %d: missing timing line for cue %q", i+1, line)
+			}
+		}
+
+		start, end, settings, err := parseVTTTiming(lines[i])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		i++
+
+		cue := Cue{Index: index, Start: start, End: end, Settings: settings}
+		for i < len(lines) && strings.TrimSpace(lines[i]) != "" {
+			if strings.Contains(lines[i], "-->") {
+				return nil, fmt.Errorf("line %d: unexpected timing line in cue text", i+1)
+			}
+			cue.Lines = append(cue.Lines, strings.TrimSpace(lines[i]))
+			i++
+		}
+		cues = append(cues, cue)
+	}
+
+	return cues, nil
+}
+
+func FormatSRT(cues []Cue) string {
+	var sb strings.Builder
+	for _, cue := range cues {
+		fmt.Fprintf(&sb, "%d\n", cue.Index)
+		fmt.Fprintf(&sb, "%s --> %s\n", FormatTimestamp(cue.Start, ','), FormatTimestamp(cue.End, ','))
+		for _, line := range cue.Original {
+			sb.WriteString(line + "\n")
+		}
+		for _, line := range cue.Lines {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func FormatVTT(cues []Cue, bilingual BilingualStyle) string {
+	var sb strings.Builder
+	sb.WriteString("WEBVTT\n\n")
+
+	styled := bilingual.Styled && hasOriginal(cues)
+	if styled {
+		sb.WriteString("STYLE\n")
+		sb.WriteString("::cue(.original) {\n")
+		fmt.Fprintf(&sb, "  color: %s;\n", bilingual.Color)
+		fmt.Fprintf(&sb, "  font-size: %d%%;\n", bilingual.Scale)
+		sb.WriteString("}\n\n")
+	}
+
+	for _, cue := range cues {
+		fmt.Fprintf(&sb, "%d\n", cue.Index)
+		fmt.Fprintf(&sb, "%s --> %s", FormatTimestamp(cue.Start, '.'), FormatTimestamp(cue.End, '.'))
+		if cue.Settings != "" {
+			sb.WriteString(" " + cue.Settings)
+		}
+		sb.WriteString("\n")
+		for _, line := range cue.Original {
+			if styled {
+				line = "<c.original>" + line + "</c>"
+			}
+			sb.WriteString(line + "\n")
+		}
+		for _, line := range cue.Lines {
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func ParseSubtitles(text string, format string) ([]Cue, error) {
+	switch format {
+	case "srt":
+		return ParseSRT(text)
+	case "vtt":
+		return ParseVTT(text)
+	}
+	return nil, fmt.Errorf("unsupported subtitles format: %s", format)
+}
+
+func FormatSubtitles(cues []Cue, format string) (string, error) {
+	switch format {
+	case "srt":
+		return FormatSRT(cues), nil
+	case "vtt":
+		return FormatVTT(cues, bilingualStyle), nil
+	case "ass":
+		return FormatASS(cues, assStyle, bilingualStyle)
+	}
+	return "", fmt.Errorf("unsupported subtitles format: %s", format)
+}
+
+// Copies WebVTT settings and, in bilingual mode, source lines from source cues with the same index
+func ApplySourceCues(cues []Cue, source []Cue, bilingual bool) []Cue {
+	sourceByIndex := make(map[int]Cue)
+	for _, cue := range source {
+		sourceByIndex[cue.Index] = cue
+	}
+
+	for i := range cues {
+		sourceCue, ok := sourceByIndex[cues[i].Index]
+		if !ok {
+			continue
+		}
+		if cues[i].Settings == "" {
+			cues[i].Settings = sourceCue.Settings
+		}
+		if bilingual {
+			cues[i].Original = sourceCue.Lines
+		}
+	}
+	return cues
+}
+
+// Matches translated cues with source cues and restores source numbering and timings.
+// Returns list of repairs which could misalign translation or error if cues can't be matched.
+func ReconcileCues(source []Cue, translated []Cue) ([]Cue, []string, error) {
+	var repairs []string
+
+	// Cue split into two entries with the same number would lose its first part
+	translatedByIndex := make(map[int]Cue)
+	for _, cue := range translated {
+		if _, ok := translatedByIndex[cue.Index]; ok {
+			return nil, nil, fmt.Errorf("translation has duplicate cue %d", cue.Index)
+		}
+		translatedByIndex[cue.Index] = cue
+	}
+
+	// Model renumbered cues, match them by position
+	var missing []string
+	for _, cue := range source {
+		if _, ok := translatedByIndex[cue.Index]; !ok {
+			missing = append(missing, strconv.Itoa(cue.Index))
+		}
+	}
+	byPosition := len(missing) > 0 && len(translated) == len(source)
+	if byPosition {
+		repairs = append(repairs, "cues renumbered, matched by position")
+	} else if len(missing) > 0 {
+		return nil, nil, fmt.Errorf("translation has %d cues instead of %d, missing cues: %s", len(translated), len(source), strings.Join(missing, ", "))
+	}
+
+	reconciled := make([]Cue, len(source))
+	for i, cue := range source {
+		var match Cue
+		if byPosition {
+			match = translated[i]
+		} else {
+			match = translatedByIndex[cue.Index]
+		}
+
+		if match.Start != cue.Start || match.End != cue.End {
+			DebugLog("Restored timing of cue", cue.Index)
+		}
+		cue.Lines = match.Lines
+		cue.Original = nil
+		reconciled[i] = cue
+	}
+
+	if len(translated) > len(source) {
+		repairs = append(repairs, fmt.Sprintf("%d unexpected cues removed", len(translated)-len(source)))
+	}
+
+	return reconciled, repairs, nil
+}
+
+func hasOriginal(cues []Cue) bool {
+	for _, cue := range cues {
+		if len(cue.Original) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns subtitles format based on file extension, false if not a subtitles file
+func SubtitlesFormatFromPath(filePath string) (string, bool) {
+	format := strings.TrimPrefix(strings.ToLower(path.Ext(filePath)), ".")
+	if format == "srt" || format == "vtt" {
+		return format, true
+	}
+	return "", false
+}
+
+// Returns timestamp in HH:MM:SS<sep>mmm format
+func FormatTimestamp(d time.Duration, sep byte) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	hours := ms / 3600000
+	minutes := ms / 60000 % 60
+	seconds := ms / 1000 % 60
+	return fmt.Sprintf("%02d:%02d:%02d%c%03d", hours, minutes, seconds, sep, ms%1000)
+}
+
+// Parses timestamp in HH:MM:SS<sep>mmm format
+func ParseTimestamp(s string, sep byte) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid timestamp %q", s)
+
+	clock, millis, found := strings.Cut(s, string(sep))
+	if !found || len(millis) != 3 {
+		return 0, invalid
+	}
+	parts := strings.Split(clock, ":")
+	if len(parts) != 3 || len(parts[1]) != 2 || len(parts[2]) != 2 {
+		return 0, invalid
+	}
+
+	var values [4]int
+	for i, part := range append(parts, millis) {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, invalid
+		}
+		values[i] = value
+	}
+	if values[1] > 59 || values[2] > 59 {
+		return 0, invalid
+	}
+
+	return time.Duration(values[0])*time.Hour +
+		time.Duration(values[1])*time.Minute +
+		time.Duration(values[2])*time.Second +
+		time.Duration(values[3])*time.Millisecond, nil
+}
+
+// Parses "<start> --> <end>" line
+func parseTiming(line string, sep byte) (time.Duration, time.Duration, error) {
+	startText, endText, found := strings.Cut(strings.TrimSpace(line), "-->")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid timing line %q", line)
+	}
+	start, err := ParseTimestamp(strings.TrimSpace(startText), sep)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := ParseTimestamp(strings.TrimSpace(endText), sep)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end < start {
+		return 0, 0, fmt.Errorf("cue ends before it starts %q", line)
+	}
+	return start, end, nil
+}
+
+// Parses "<start> --> <end> [settings]" line, hours are optional in WebVTT
+func parseVTTTiming(line string) (time.Duration, time.Duration, string, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || fields[1] != "-->" {
+		return 0, 0, "", fmt.Errorf("invalid timing line %q", line)
+	}
+
+	var times [2]time.Duration
+	for i, field := range []string{fields[0], fields[2]} {
+		if strings.Count(field, ":") == 1 {
+			field = "00:" + field
+		}
+		value, err := ParseTimestamp(field, '.')
+		if err != nil {
+			return 0, 0, "", err
+		}
+		times[i] = value
+	}
+	if times[1] < times[0] {
+		return 0, 0, "", fmt.Errorf("cue ends before it starts %q", line)
+	}
+
+	return times[0], times[1], strings.Join(fields[3:], " "), nil
+}
+
+func isVTTHeader(line string) bool {
+	return line == "WEBVTT" || strings.HasPrefix(line, "WEBVTT ") || strings.HasPrefix(line, "WEBVTT\t")
+}
+
+func isVTTBlock(line string, keyword string) bool {
+	return line == keyword || strings.HasPrefix(line, keyword+" ") || strings.HasPrefix(line, keyword+"\t")
+}
+
+// Normalizes line endings and removes BOM
+func splitLines(text string) []string {
+	text = strings.TrimPrefix(text, "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ms(value int) time.Duration {
+	return time.Duration(value) * time.Millisecond
+}
+
+func TestParseSRT(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Cue
+		err  string
+	}{
+		{
+			name: "two cues",
+			text: "1\n00:00:01,000 --> 00:00:02,500\nHello\nworld\n\n2\n01:02:03,004 --> 01:02:04,000\nBye\n",
+			want: []Cue{
+				{Index: 1, Start: ms(1000), End: ms(2500), Lines: []string{"Hello", "world"}},
+				{Index: 2, Start: time.Hour + 2*time.Minute + 3*time.Second + ms(4), End: time.Hour + 2*time.Minute + 4*time.Second, Lines: []string{"Bye"}},
+			},
+		},
+		{
+			name: "BOM and CRLF",
+			text: "\ufeff1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n",
+			want: []Cue{{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"Hello"}}},
+		},
+		{
+			name: "extra blank lines",
+			text: "\n\n1\n00:00:01,000 --> 00:00:02,000\nA\n\n\n\n2\n00:00:03,000 --> 00:00:04,000\nB",
+			want: []Cue{
+				{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"A"}},
+				{Index: 2, Start: ms(3000), End: ms(4000), Lines: []string{"B"}},
+			},
+		},
+		{
+			name: "cue without text",
+			text: "1\n00:00:01,000 --> 00:00:02,000\n\n",
+			want: []Cue{{Index: 1, Start: ms(1000), End: ms(2000)}},
+		},
+		{
+			name: "invalid index",
+			text: "1\n00:00:01,000 --> 00:00:02,000\nA\n\nfoo\n00:00:03,000 --> 00:00:04,000\nB\n",
+			err:  "line 5: invalid cue index",
+		},
+		{
+			name: "missing timing line",
+			text: "1\n\nA\n",
+			err:  "line 2: missing timing line",
+		},
+		{
+			name: "WebVTT separator",
+			text: "1\n00:00:01.000 --> 00:00:02.000\nA\n",
+			err:  "line 2: invalid timestamp",
+		},
+		{
+			name: "ends before start",
+			text: "1\n00:00:02,000 --> 00:00:01,000\nA\n",
+			err:  "line 2: cue ends before it starts",
+		},
+		{
+			name: "minutes out of range",
+			text: "1\n00:60:00,000 --> 01:00:01,000\nA\n",
+			err:  "line 2: invalid timestamp",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cues, err := ParseSRT(test.text)
+			checkParse(t, cues, err, test.want, test.err)
+		})
+	}
+}
+
+func TestParseVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []Cue
+		err  string
+	}{
+		{
+			name: "optional hours and settings",
+			text: "WEBVTT\n\n00:01.000 --> 00:02.500 align:start position:10%\nHello\n\n01:00:00.000 --> 01:00:01.000\nBye\n",
+			want: []Cue{
+				{Index: 1, Start: ms(1000), End: ms(2500), Lines: []string{"Hello"}, Settings: "align:start position:10%"},
+				{Index: 2, Start: time.Hour, End: time.Hour + time.Second, Lines: []string{"Bye"}},
+			},
+		},
+		{
+			name: "header text, BOM and CRLF",
+			text: "\ufeffWEBVTT - subtitles\r\nKind: captions\r\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n",
+			want: []Cue{{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"Hello"}}},
+		},
+		{
+			name: "identifiers numbered by position",
+			text: "WEBVTT\n\nintro\n00:01.000 --> 00:02.000\nA\n\n1\n00:03.000 --> 00:04.000\nB\n\n7\n00:05.000 --> 00:06.000\nC\n",
+			want: []Cue{
+				{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"A"}},
+				{Index: 2, Start: ms(3000), End: ms(4000), Lines: []string{"B"}},
+				{Index: 3, Start: ms(5000), End: ms(6000), Lines: []string{"C"}},
+			},
+		},
+		{
+			name: "NOTE, STYLE and REGION blocks",
+			text: "WEBVTT\n\nNOTE comment\nmore comment\n\nSTYLE\n::cue { color: red; }\n\nREGION\nid:top\n\n00:01.000 --> 00:02.000\nA\n",
+			want: []Cue{{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"A"}}},
+		},
+		{
+			name: "missing header",
+			text: "00:01.000 --> 00:02.000\nA\n",
+			err:  "line 1: missing WEBVTT header",
+		},
+		{
+			name: "identifier without timing line",
+			text: "WEBVTT\n\nintro\n\n00:01.000 --> 00:02.000\nA\n",
+			err:  "line 4: missing timing line",
+		},
+		{
+			name: "SRT separator",
+			text: "WEBVTT\n\n00:00:01,000 --> 00:00:02,000\nA\n",
+			err:  "line 3: invalid timestamp",
+		},
+		{
+			name: "timing line in text",
+			text: "WEBVTT\n\n00:01.000 --> 00:02.000\nA\n00:03.000 --> 00:04.000\nB\n",
+			err:  "line 5: unexpected timing line",
+		},
+		{
+			name: "ends before start",
+			text: "WEBVTT\n\n00:02.000 --> 00:01.000\nA\n",
+			err:  "line 3: cue ends before it starts",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cues, err := ParseVTT(test.text)
+			checkParse(t, cues, err, test.want, test.err)
+		})
+	}
+}
+
+func checkParse(t *testing.T, cues []Cue, err error, want []Cue, wantErr string) {
+	t.Helper()
+	if wantErr != "" {
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Fatalf("error = %v, want %q", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(cues, want) {
+		t.Fatalf("cues = %+v, want %+v", cues, want)
+	}
+}
+
+func TestReconcileCues(t *testing.T) {
+	source := []Cue{
+		{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"a"}, Settings: "align:start"},
+		{Index: 2, Start: ms(3000), End: ms(4000), Lines: []string{"b"}},
+		{Index: 3, Start: ms(5000), End: ms(6000), Lines: []string{"c"}},
+	}
+
+	tests := []struct {
+		name       string
+		translated []Cue
+		want       []string
+		repairs    int
+		err        string
+	}{
+		{
+			name: "matching cues",
+			translated: []Cue{
+				{Index: 1, Start: ms(1000), End: ms(2000), Lines: []string{"A"}},
+				{Index: 2, Start: ms(3000), End: ms(4000), Lines: []string{"B"}},
+				{Index: 3, Start: ms(5000), End: ms(6000), Lines: []string{"C"}},
+			},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			name: "changed timings are restored",
+			translated: []Cue{
+				{Index: 1, Start: ms(1100), End: ms(2000), Lines: []string{"A"}},
+				{Index: 2, Start: ms(3000), End: ms(4200), Lines: []string{"B"}},
+				{Index: 3, Lines: []string{"C"}},
+			},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			name: "reordered cues",
+			translated: []Cue{
+				{Index: 3, Lines: []string{"C"}},
+				{Index: 1, Lines: []string{"A"}},
+				{Index: 2, Lines: []string{"B"}},
+			},
+			want: []string{"A", "B", "C"},
+		},
+		{
+			name: "renumbered cues",
+			translated: []Cue{
+				{Index: 11, Lines: []string{"A"}},
+				{Index: 12, Lines: []string{"B"}},
+				{Index: 13, Lines: []string{"C"}},
+			},
+			want:    []string{"A", "B", "C"},
+			repairs: 1,
+		},
+		{
+			name: "extra cue",
+			translated: []Cue{
+				{Index: 1, Lines: []string{"A"}},
+				{Index: 2, Lines: []string{"B"}},
+				{Index: 3, Lines: []string{"C"}},
+				{Index: 4, Lines: []string{"D"}},
+			},
+			want:    []string{"A", "B", "C"},
+			repairs: 1,
+		},
+		{
+			name: "dropped cue",
+			translated: []Cue{
+				{Index: 1, Lines: []string{"A"}},
+				{Index: 3, Lines: []string{"C"}},
+			},
+			err: "missing cues: 2",
+		},
+		{
+			name: "duplicate cue",
+			translated: []Cue{
+				{Index: 1, Lines: []string{"A1"}},
+				{Index: 1, Lines: []string{"A2"}},
+				{Index: 2, Lines: []string{"B"}},
+				{Index: 3, Lines: []string{"C"}},
+			},
+			err: "duplicate cue 1",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cues, repairs, err := ReconcileCues(source, test.translated)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("error = %v, want %q", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(repairs) != test.repairs {
+				t.Errorf("repairs = %q, want %d", repairs, test.repairs)
+			}
+
+			if len(cues) != len(source) {
+				t.Fatalf("got %d cues, want %d", len(cues), len(source))
+			}
+			for i, cue := range cues {
+				if cue.Index != source[i].Index || cue.Start != source[i].Start || cue.End != source[i].End || cue.Settings != source[i].Settings {
+					t.Errorf("cue %d = %+v, want numbering and timing of %+v", i, cue, source[i])
+				}
+				if cue.Text() != test.want[i] {
+					t.Errorf("cue %d text = %q, want %q", i, cue.Text(), test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+)
+
+// [whisper] section of config file
+type WhisperConfig struct {
+	WhisperPrompt
+	// Profile used without --profile argument
+	Profile  string
+	Profiles map[string]WhisperPrompt
+}
+
+// Vocabulary hints for whisper, profiles override only fields which are set
+type WhisperPrompt struct {
+	// Initial prompt, e.g. names, domain vocabulary and punctuation style
+	Prompt string
+	// File with initial prompt, used instead of Prompt when set
+	PromptFile string `toml:"prompt_file"`
+	// faster-whisper only, appended to prompt with whisper.cpp
+	Hotwords string
+}
+
+// Returns prompt text and hotwords of base config merged with selected profile
+func ResolveWhisperPrompt(config WhisperConfig, profile string) (string, string, error) {
+	prompt := config.WhisperPrompt
+	if profile == "" {
+		profile = config.Profile
+	}
+	if profile != "" {
+		override, ok := config.Profiles[profile]
+		if !ok {
+			var names []string
+			for name := range config.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", "", errors.New("unknown whisper profile \"" + profile + "\", available: " + strings.Join(names, ", "))
+		}
+		if override.Prompt != "" || override.PromptFile != "" {
+			prompt.Prompt = override.Prompt
+			prompt.PromptFile = override.PromptFile
+		}
+		if override.Hotwords != "" {
+			prompt.Hotwords = override.Hotwords
+		}
+	}
+
+	text := prompt.Prompt
+	if prompt.PromptFile != "" {
+		buff, err := os.ReadFile(prompt.PromptFile)
+		if err != nil {
+			return "", "", err
+		}
+		text = string(buff)
+	}
+	return strings.TrimSpace(text), strings.TrimSpace(prompt.Hotwords), nil
+}
+
+// Language of transcription detected by whisper
+type TranscriptionInfo struct {
+	// ISO 639-1 code used by whisper
+	Language string `json:"language"`
+	// 0 when not reported (whisper.cpp)
+	Probability float64 `json:"probability"`
+}
+
+// Reads json file saved by transcribe.py with --info argument
+func ReadTranscriptionInfo(infoPath string) (*TranscriptionInfo, error) {
+	buff, err := os.ReadFile(infoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var info TranscriptionInfo
+	if err := json.Unmarshal(buff, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Reads language from json file saved by whisper.cpp with --output-json argument
+func ReadWhisperCppInfo(jsonPath string) (*TranscriptionInfo, error) {
+	buff, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var output struct {
+		Result struct {
+			Language string `json:"language"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(buff, &output); err != nil {
+		return nil, err
+	}
+	return &TranscriptionInfo{Language: output.Result.Language}, nil
+}
+
+// transcribe.py is extracted only during installation, older versions don't support newer arguments
+func ScriptSupports(scriptPath string, arg string) bool {
+	buff, err := os.ReadFile(scriptPath)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(buff), "'"+arg+"'")
+}
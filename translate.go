@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/google/generative-ai-go/genai"
+)
+
+// Translation backend, implements ChatTranslator or MachineTranslator
+type Translator interface {
+	// Backend and model, used in cache keys
+	Name() string
+	Close() error
+}
+
+// Prompt based backend (LLM), prompts and response validation are shared by all chat backends
+type ChatTranslator interface {
+	Translator
+	// Sends single stateless request with system instruction and returns response text,
+	// token usage is returned also with IncompleteResponseError
+	Complete(ctx context.Context, system string, prompt string) (string, Usage, error)
+}
+
+// Machine translation backend, translates text of each cue without prompts
+type MachineTranslator interface {
+	Translator
+	TranslateTexts(ctx context.Context, texts []string, lang string) ([]string, error)
+}
+
+// Chat requests per chunk before giving up on invalid translation
+const maxRepairAttempts = 3
+
+// Available backends for --translator
+var translatorNames = map[string]string{
+	"gemini":         "Google Gemini AI",
+	"openai":         "OpenAI-compatible API",
+	"ollama":         "Ollama",
+	"libretranslate": "LibreTranslate",
+}
+
+// Message of chat conversation used by OpenAI-compatible and Ollama APIs
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func NewTranslator(ctx context.Context, name string, config Config, jsonMode bool) (Translator, error) {
+	switch name {
+	case "gemini":
+		return NewGeminiTranslator(ctx, config.Key, jsonMode)
+	case "openai":
+		return NewOpenAITranslator(config.OpenAI), nil
+	case "ollama":
+		return NewOllamaTranslator(config.Ollama, jsonMode), nil
+	case "libretranslate":
+		return NewLibreTranslator(config.LibreTranslate), nil
+	}
+	return nil, fmt.Errorf("unsupported translator: %s", name)
+}
+
+// Options shared by all chunks of translation
+type TranslateOptions struct {
+	Lang     string
+	JSONMode bool
+	// Rendered prompt template, used by chat translators
+	Prompt   string
+	Glossary Glossary
+	// Previous cues sent as context when chunk is split
+	ContextCues int
+	Retry       RetryPolicy
+	// Nil when disabled with --no-cache
+	Cache *Cache
+	// Totals of all requests, nil when not collected
+	Usage *Usage
+	// Chunks matched by position or with removed cues, nil when not collected
+	Warnings *[]string
+}
+
+// Cue left in source language because translator couldn't finish it
+type FailedCue struct {
+	Index  int
+	Reason string
+}
+
+// Translates chunk of cues, returned cues keep source numbering and timings.
+// Previous cues (source lines in Original, translation in Lines) are sent to chat
+// translators as read-only context, each chunk is translated in independent request.
+// Chunks with incomplete response are split in half and translated again, single cue
+// that still can't be translated keeps its source text and is returned in failed list.
+func TranslateChunk(ctx context.Context, translator Translator, chunk []Cue, previous []Cue, opts TranslateOptions) ([]Cue, []FailedCue, error) {
+	translated, err := translateChunk(ctx, translator, chunk, previous, opts)
+	var incomplete *IncompleteResponseError
+	if !errors.As(err, &incomplete) {
+		return translated, nil, err
+	}
+
+	if len(chunk) == 1 {
+		cue := chunk[0]
+		cue.Original = nil
+		DebugLog("Keeping source text of cue", cue.Index, "-", incomplete.Reason)
+		return []Cue{cue}, []FailedCue{{Index: cue.Index, Reason: incomplete.Reason}}, nil
+	}
+
+	half := len(chunk) / 2
+	DebugLog("Splitting request into", half, "and", len(chunk)-half, "cues -", incomplete.Reason)
+	first, failed, err := TranslateChunk(ctx, translator, chunk[:half], previous, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Second half gets translated first half as context
+	secondPrevious := append(append([]Cue{}, previous...), PreviousCues(chunk[:half], first, opts.ContextCues)...)
+	if len(secondPrevious) > opts.ContextCues {
+		secondPrevious = secondPrevious[len(secondPrevious)-opts.ContextCues:]
+	}
+	second, secondFailed, err := TranslateChunk(ctx, translator, chunk[half:], secondPrevious, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return append(first, second...), append(failed, secondFailed...), nil
+}
+
+func translateChunk(ctx context.Context, translator Translator, chunk []Cue, previous []Cue, opts TranslateOptions) ([]Cue, error) {
+	switch t := translator.(type) {
+	case MachineTranslator:
+		return translateMachineChunk(ctx, t, chunk, opts)
+	case ChatTranslator:
+		return translateChatChunk(ctx, t, chunk, previous, opts)
+	}
+	return nil, errors.New("unsupported translator type")
+}
+
+func translateMachineChunk(ctx context.Context, translator MachineTranslator, chunk []Cue, opts TranslateOptions) ([]Cue, error) {
+	texts := make([]string, len(chunk))
+	for i, cue := range chunk {
+		texts[i] = cue.Text()
+	}
+
+	var translations []string
+	key := CacheKey(append([]string{translator.Name(), opts.Lang}, texts...)...)
+	if res, ok := opts.Cache.Get(key); ok && json.Unmarshal([]byte(res), &translations) == nil && len(translations) == len(chunk) {
+		DebugLog("Translation loaded from cache")
+	} else {
+		err := opts.Retry.Do(ctx, func() error {
+			var err error
+			translations, err = translator.TranslateTexts(ctx, texts, opts.Lang)
+			opts.Usage.Add(Usage{Requests: 1})
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if buff, err := json.Marshal(translations); err == nil {
+			if err := opts.Cache.Put(key, string(buff)); err != nil {
+				DebugLog("Couldn't save translation in cache:", err)
+			}
+		}
+	}
+	if len(translations) != len(chunk) {
+		return nil, fmt.Errorf("translation has %d cues instead of %d", len(translations), len(chunk))
+	}
+
+	translated := make([]Cue, len(chunk))
+	for i, cue := range chunk {
+		cue.Lines = splitCueText(translations[i])
+		cue.Original = nil
+		translated[i] = cue
+	}
+	return translated, nil
+}
+
+func translateChatChunk(ctx context.Context, translator ChatTranslator, chunk []Cue, previous []Cue, opts TranslateOptions) ([]Cue, error) {
+	system := opts.Prompt + " "
+	section := FormatSRT(chunk)
+	keep := "the original numbers and timestamps"
+	if opts.JSONMode {
+		var err error
+		section, err = CuesToJSON(chunk)
+		if err != nil {
+			return nil, err
+		}
+		keep = "the original ids"
+		system += "Translate only the \"text\" fields and return them as a JSON array with the same \"id\" values and translated \"text\", keep line breaks."
+	} else {
+		system += "Return them as valid SRT subtitles with the original numbers and timestamps."
+	}
+	if glossary := opts.Glossary.Instruction(); glossary != "" {
+		system += "\n" + glossary
+	}
+
+	var contextText string
+	if len(previous) > 0 {
+		contextText = "Previous subtitles and their translations, for context only, do not translate or return them:\n"
+		for _, cue := range previous {
+			contextText += strings.Join(cue.Original, " ") + " => " + strings.Join(cue.Lines, " ") + "\n"
+		}
+		contextText += "\n"
+	}
+	prompt := contextText + "Subtitles to translate:\n" + section
+
+	// Valid response is cached under the first prompt, even if it took a few attempts
+	key := CacheKey(translator.Name(), system, prompt)
+	if res, ok := opts.Cache.Get(key); ok {
+		if translated, repairs, err := parseChatResponse(chunk, res, opts.JSONMode); err == nil {
+			DebugLog("Translation loaded from cache")
+			opts.warn(chunk, repairs)
+			return translated, nil
+		}
+	}
+
+	// Validate response and ask again if cues can't be matched with the source
+	for attempt := 1; ; attempt++ {
+		var res string
+		err := opts.Retry.Do(ctx, func() error {
+			var usage Usage
+			var err error
+			res, usage, err = translator.Complete(ctx, system, prompt)
+			usage.Requests = 1
+			opts.Usage.Add(usage)
+			DebugLog("Request tokens, input:", usage.InputTokens, "output:", usage.OutputTokens)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		translated, repairs, err := parseChatResponse(chunk, res, opts.JSONMode)
+		if err == nil {
+			opts.warn(chunk, repairs)
+			if err := opts.Cache.Put(key, res); err != nil {
+				DebugLog("Couldn't save translation in cache:", err)
+			}
+			return translated, nil
+		}
+
+		if attempt == maxRepairAttempts {
+			return nil, fmt.Errorf("translator returned invalid subtitles: %v", err)
+		}
+		DebugLog("Invalid translation:", err)
+		DebugLog("Requesting again...")
+		prompt = contextText + "Your previous answer was invalid: " + err.Error() + ". Return exactly " + strconv.Itoa(len(chunk)) + " subtitles with " + keep + ". Subtitles to translate:\n" + section
+	}
+}
+
+// Repaired chunks are reported after translation, they might be misaligned with the source
+func (o TranslateOptions) warn(chunk []Cue, repairs []string) {
+	for _, repair := range repairs {
+		DebugLog("Repaired translation:", repair)
+		if o.Warnings != nil {
+			*o.Warnings = append(*o.Warnings, fmt.Sprintf("cues %d-%d: %s", chunk[0].Index, chunk[len(chunk)-1].Index, repair))
+		}
+	}
+}
+
+// Returns translated cues and list of repaired differences
+func parseChatResponse(chunk []Cue, res string, jsonMode bool) ([]Cue, []string, error) {
+	if jsonMode {
+		translated, err := CuesFromJSON(chunk, res)
+		return translated, nil, err
+	}
+
+	translated, err := ParseSRT(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ReconcileCues(chunk, translated)
+}
+
+// Splits --lang value, e.g. "japanese,ko,spa"
+func ParseLangs(value string) []Language {
+	var langs []Language
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(value, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		lang := ParseLanguage(item)
+		if seen[strings.ToLower(lang.Name)] {
+			continue
+		}
+		seen[strings.ToLower(lang.Name)] = true
+		langs = append(langs, lang)
+	}
+	return langs
+}
+
+func LanguageNames(langs []Language) []string {
+	names := make([]string, len(langs))
+	for i, lang := range langs {
+		names[i] = lang.Name
+	}
+	return names
+}
+
+// File name without extension, language code is added only when translating into multiple languages
+func LangFileName(fileName string, langs []Language, lang Language) string {
+	if len(langs) > 1 {
+		return fileName + "." + lang.FileCode()
+	}
+	return fileName
+}
+
+// Returns up to count cues preceding chunk start, with source lines in Original and translation in Lines
+func PreviousCues(source []Cue, translated []Cue, count int) []Cue {
+	start := len(translated) - count
+	if start < 0 {
+		start = 0
+	}
+
+	var previous []Cue
+	for i := start; i < len(translated) && i < len(source); i++ {
+		cue := translated[i]
+		cue.Original = source[i].Lines
+		previous = append(previous, cue)
+	}
+	return previous
+}
+
+// Cue sent to and received from translator in JSON mode, without numbering and timings
+type jsonCue struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// Gemini response schema for JSON mode
+var jsonCuesSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"id":   {Type: genai.TypeInteger},
+			"text": {Type: genai.TypeString},
+		},
+		Required: []string{"id", "text"},
+	},
+}
+
+func CuesToJSON(cues []Cue) (string, error) {
+	items := make([]jsonCue, len(cues))
+	for i, cue := range cues {
+		items[i] = jsonCue{ID: cue.Index, Text: cue.Text()}
+	}
+
+	buff, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(buff), nil
+}
+
+// Parses translator response and rebuilds cues using source numbering and timings
+func CuesFromJSON(source []Cue, text string) ([]Cue, error) {
+	var items []jsonCue
+	if err := json.Unmarshal([]byte(text), &items); err != nil {
+		return nil, fmt.Errorf("invalid JSON response: %v", err)
+	}
+
+	translations := make(map[int]string)
+	for _, item := range items {
+		if _, ok := translations[item.ID]; ok {
+			return nil, fmt.Errorf("translation has duplicate id %d", item.ID)
+		}
+		translations[item.ID] = item.Text
+	}
+
+	var missing []string
+	cues := make([]Cue, len(source))
+	for i, cue := range source {
+		translation, ok := translations[cue.Index]
+		if !ok {
+			missing = append(missing, strconv.Itoa(cue.Index))
+			continue
+		}
+
+		cue.Lines = splitCueText(translation)
+		cue.Original = nil
+		cues[i] = cue
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("translation has %d cues instead of %d, missing ids: %s", len(items), len(source), strings.Join(missing, ", "))
+	}
+	return cues, nil
+}
+
+// Splits translated text into cue lines, skipping empty ones
+func splitCueText(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// Backend able to count tokens with model's tokenizer
+type TokenCounter interface {
+	CountTokens(ctx context.Context, text string) (int, error)
+}
+
+// Rough token count, CJK characters are usually one token each, other text about 4 characters per token
+func EstimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
+
+// Returns token counting function based on local estimate, calibrated once
+// with translator's tokenizer on sample text when translator supports it
+func NewTokenEstimator(ctx context.Context, translator Translator, sample string) func(string) int {
+	ratio := 1.0
+	if counter, ok := translator.(TokenCounter); ok && sample != "" {
+		tokens, err := counter.CountTokens(ctx, sample)
+		if err != nil {
+			DebugLog("Token count error, using local estimate:", err)
+		} else if estimate := EstimateTokens(sample); estimate > 0 {
+			ratio = float64(tokens) / float64(estimate)
+			DebugLog("Tokens count:", tokens, "local estimate:", estimate)
+		}
+	}
+
+	return func(text string) int {
+		return int(math.Ceil(float64(EstimateTokens(text)) * ratio))
+	}
+}
+
+// Splits cues into chunks fitting token budget, cues are never split between chunks
+func SplitChunks(cues []Cue, budget int, countTokens func(string) int) [][]Cue {
+	var chunks [][]Cue
+	var chunk []Cue
+	var chunkTokens int
+	for _, cue := range cues {
+		tokens := countTokens(FormatSRT([]Cue{cue}))
+		if len(chunk) > 0 && chunkTokens+tokens > budget {
+			chunks = append(chunks, chunk)
+			chunk = nil
+			chunkTokens = 0
+		}
+		chunk = append(chunk, cue)
+		chunkTokens += tokens
+	}
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tokens used by translation requests, cached responses are not counted
+type Usage struct {
+	Requests     int
+	InputTokens  int
+	OutputTokens int
+}
+
+// Nil usage (not collected) ignores added values
+func (u *Usage) Add(other Usage) {
+	if u == nil {
+		return
+	}
+	u.Requests += other.Requests
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// Price in USD per million tokens, entry of [prices] section of config file
+type ModelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// Returns estimated cost in USD, price is matched by model name at the end of translator name
+func (u Usage) Cost(translatorName string, prices map[string]ModelPrice) (float64, bool) {
+	for model, price := range prices {
+		if translatorName == model || strings.HasSuffix(translatorName, "/"+model) {
+			return (float64(u.InputTokens)*price.Input + float64(u.OutputTokens)*price.Output) / 1000000, true
+		}
+	}
+	return 0, false
+}
+
+// Appends run totals to usage.csv in program dir, header is written with the first entry.
+// Cost is left empty when model has no price, so it isn't counted as free.
+func AppendUsageLog(usage Usage, translatorName string, langs []string, cost float64, priced bool, input string) error {
+	logPath := path.Join(appDir, "usage.csv")
+	isNew := !FileExists(logPath)
+
+	file, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if isNew {
+		writer.Write([]string{"date", "translator", "languages", "requests", "input_tokens", "output_tokens", "cost_usd", "input"})
+	}
+	var costText string
+	if priced {
+		costText = fmt.Sprintf("%.6f", cost)
+	}
+	writer.Write([]string{
+		time.Now().Format(time.RFC3339),
+		translatorName,
+		strings.Join(langs, " "),
+		strconv.Itoa(usage.Requests),
+		strconv.Itoa(usage.InputTokens),
+		strconv.Itoa(usage.OutputTokens),
+		costText,
+		input,
+	})
+	writer.Flush()
+	return writer.Error()
+}
@@ -7,7 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
+	"strconv"
 	"strings"
 
 	"github.com/google/generative-ai-go/genai"
@@ -27,6 +27,12 @@ func PrintError(err error) {
 }
 
 func RunCommand(loadingMessage string, args ...string) {
+	// --dry-run only shows the command
+	if dryRunMode {
+		PrintPlan(loadingMessage, FormatCommand(args))
+		return
+	}
+
 	cmd := exec.Command(args[0], args[1:]...)
 	if commandCurrentDir {
 		cmd.Dir = appDir
@@ -63,12 +69,16 @@ func RunCommand(loadingMessage string, args ...string) {
 	}
 }
 
-func PrintResponse(resp *genai.GenerateContentResponse) string {
+// Returns text of Gemini response or IncompleteResponseError when response was cut off or blocked
+func PrintResponse(resp *genai.GenerateContentResponse) (string, error) {
+	if len(resp.Candidates) == 0 {
+		return "", errors.New("empty response from Google Gemini")
+	}
+
 	var text string
 	for _, cand := range resp.Candidates {
-		if cand.FinishReason != genai.FinishReasonStop {
-			fmt.Println(redANSI + "Finish reason other than [STOP]" + resetANSI)
-			fmt.Println("Finish reason:", cand.FinishReason)
+		if cand.FinishReason != genai.FinishReasonStop && cand.FinishReason != genai.FinishReasonUnspecified {
+			return "", &IncompleteResponseError{Reason: strings.TrimPrefix(cand.FinishReason.String(), "FinishReason")}
 		}
 
 		if cand.Content != nil {
@@ -79,6 +89,33 @@ func PrintResponse(resp *genai.GenerateContentResponse) string {
 		}
 	}
 
+	return TrimCodeFence(text), nil
+}
+
+// Returns ffmpeg command embedding every subtitles file as separate track,
+// audio is tagged with source language when it is known
+func EmbedCommand(video string, subtitles []string, langs []Language, audioLang Language, format string, output string) []string {
+	args := []string{"ffmpeg", "-y", "-i", video}
+	for _, subtitlesFile := range subtitles {
+		args = append(args, "-i", subtitlesFile)
+	}
+	args = append(args, "-map", "0:v?", "-map", "0:a?")
+	for i := range subtitles {
+		args = append(args, "-map", strconv.Itoa(i+1))
+	}
+	args = append(args, "-c", "copy", "-c:s", subtitleCodecs[format])
+	for i, lang := range langs {
+		args = append(args, "-metadata:s:s:"+strconv.Itoa(i), "language="+lang.TrackCode())
+		args = append(args, "-metadata:s:s:"+strconv.Itoa(i), "title="+lang.Name)
+	}
+	if audioLang.Code3 != "" {
+		args = append(args, "-metadata:s:a:0", "language="+audioLang.Code3)
+	}
+	return append(args, output)
+}
+
+// Removes markdown code block around model response
+func TrimCodeFence(text string) string {
 	// Remove first line if it starts with "```"
 	if strings.HasPrefix(text, "```") {
 		index := strings.Index(text, "\n")
@@ -98,34 +135,6 @@ func PrintResponse(resp *genai.GenerateContentResponse) string {
 	return text
 }
 
-func ParseSRT(text string) []string {
-	// Split text into lines
-	lines := strings.Split(text, "\n")
-	var sections []string
-	var currentSection []string
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		// If line is emtpy = end of str section
-		if trimmedLine == "" {
-			if len(currentSection) > 0 {
-				sections = append(sections, strings.Join(currentSection, "\n"))
-				currentSection = []string{}
-			}
-		} else {
-			currentSection = append(currentSection, trimmedLine)
-		}
-	}
-
-	// Add last line if exists
-	if len(currentSection) > 0 {
-		sections = append(sections, strings.Join(currentSection, "\n"))
-	}
-
-	return sections
-}
-
 func FileExists(filePath string) bool {
 	_, error := os.Stat(filePath)
 	return !errors.Is(error, os.ErrNotExist)
@@ -171,6 +180,49 @@ func MoveFile(sourcePath, destPath string) error {
 	return nil
 }
 
+// Reads .srt or .vtt file, files with other extensions are treated as .srt
+func ReadSubtitlesFile(filePath string) ([]Cue, error) {
+	format, ok := SubtitlesFormatFromPath(filePath)
+	if !ok {
+		format = "srt"
+	}
+
+	buff, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSubtitles(string(buff), format)
+}
+
+// Converts .srt file from tmp dir into given format and removes the source file.
+// Source cues (optional) are used to restore WebVTT cue settings lost in .srt
+// and to add original lines above translation in bilingual mode.
+func ExportSubtitles(sourcePath, destPath, format string, source []Cue, bilingual bool) error {
+	if format == "srt" && !bilingual {
+		return MoveFile(sourcePath, destPath)
+	}
+
+	DebugLog("Converting file:", sourcePath, "to", format, "destination:", destPath)
+	cues, err := ReadSubtitlesFile(sourcePath)
+	if err != nil {
+		return fmt.Errorf("Couldn't parse source file: %v", err)
+	}
+	cues = ApplySourceCues(cues, source, bilingual)
+
+	text, err := FormatSubtitles(cues, format)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(destPath, []byte(text), 0644); err != nil {
+		return fmt.Errorf("Couldn't write dest file: %v", err)
+	}
+
+	if err := os.Remove(sourcePath); err != nil {
+		return fmt.Errorf("Couldn't remove source file: %v", err)
+	}
+	return nil
+}
+
 // https://gophercoding.com/download-a-file/
 func DownloadFile(url string, filepath string) error {
 	// Get the data
@@ -197,25 +249,3 @@ func DownloadFile(url string, filepath string) error {
 	_, err = io.Copy(out, resp.Body)
 	return err
 }
-
-func GenerateConfig() {
-	configText := `# Google Gemini API key:
-key = "insert-key-here"
-
-# Your CPU threads
-threads = "8"
-
-# Chose whisper model
-# example: large-v3, medium, small, tiny
-model = "medium"
-
-# Force usage of whisper.cpp version without --cpp argument
-# Enabled by default on Windows regardless of this setting
-cpp = false
-`
-	if err := os.WriteFile(path.Join(appDir, "config.toml"), []byte(configText), 0644); err != nil {
-		PrintError(err)
-		os.Exit(1)
-	}
-	fmt.Println("Created config file:", path.Join(appDir, "config.toml"))
-}